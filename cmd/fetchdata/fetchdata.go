@@ -1,40 +1,92 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"crypto_project/config"
+	"crypto_project/pkg/binance"
 	"crypto_project/pkg/cryptocompare"
 	"crypto_project/pkg/db"
+	"crypto_project/pkg/lake"
 	"crypto_project/pkg/models"
+	"crypto_project/pkg/provider"
 
 	"github.com/shopspring/decimal"
 	"github.com/sirupsen/logrus"
 )
 
+// defaultIncrementalOverlap is how many stored bars are fetched again by incremental jobs, the
+// most recent stored bars may have been saved before the API finalized them
+const defaultIncrementalOverlap = 3
+
+const configFile = "config.toml"
+
 type downloadJob struct {
+	exchange   string
 	symbol     string
 	vsCurrency string
-	timeframe  string
+	timeframe  models.Timeframe
 	limit      int
-	wg         *sync.WaitGroup
+	// from is set for incremental jobs, which fetch the bars from it to now instead of limit bars
+	from time.Time
+	// record aggregates the outcome of the job and of saving its data
+	record *jobRecord
+	wg     *sync.WaitGroup
 }
 
 type saveJob struct {
+	// exchange and provider are stored with each candle
+	exchange   string
+	provider   string
 	symbol     string
 	vsCurrency string
-	data       []cryptocompare.OHLCVData
-	timeframe  string
-	wg         *sync.WaitGroup
+	data       []provider.Bar
+	timeframe  models.Timeframe
+	// fetchAll is set for pages of fetch all jobs, large ones are saved with the bulk loader
+	fetchAll bool
+	// last is set for the last save job of a download job, the data of the download job
+	// buffered for the Parquet lake is merged then
+	last   bool
+	record *jobRecord
+	wg     *sync.WaitGroup
+}
+
+// market returns the market to fetch from the provider
+func (j downloadJob) market() provider.Market {
+	return provider.Market{Exchange: j.exchange, Symbol: j.symbol, VsCurrency: j.vsCurrency}
+}
+
+// pair returns the trading pair of the job, qualified with the exchange if any
+func (j downloadJob) pair() string {
+	return pairName(j.exchange, j.symbol, j.vsCurrency)
+}
+
+// pair returns the trading pair of the job, qualified with the exchange if any
+func (j saveJob) pair() string {
+	return pairName(j.exchange, j.symbol, j.vsCurrency)
+}
+
+func pairName(exchange, symbol, vsCurrency string) string {
+	if exchange == "" {
+		return fmt.Sprintf("%s/%s", symbol, vsCurrency)
+	}
+	return fmt.Sprintf("%s:%s/%s", exchange, symbol, vsCurrency)
 }
 
 func main() {
 	fetchAll := flag.Bool("fetch-all", false, "Fetch all data")
+	incremental := flag.Bool("incremental", false, "Fetch the data missing since the latest stored bar of each series")
+	repair := flag.Bool("repair", false, "Scan the stored series for gaps and fetch the missing bars from cryptocompare")
+	retryFailed := flag.Bool("retry-failed", false, "Retry the jobs of the latest run which did not succeed")
 	flag.Parse()
 
 	log := logrus.New()
@@ -42,7 +94,7 @@ func main() {
 	log.Level = logrus.DebugLevel
 
 	log.Trace("Reading config")
-	conf, err := config.ReadConfig("config.toml")
+	conf, err := config.ReadConfig(configFile)
 	if err != nil {
 		log.Fatal("Error reading config: ")
 		log.Panic(err)
@@ -50,6 +102,15 @@ func main() {
 
 	log.Debug("Config loaded successfully")
 
+	mode := fetchMode(*fetchAll, *incremental, *repair, *retryFailed)
+	if mode == "" {
+		log.Fatal("--fetch-all, --incremental, --repair and --retry-failed cannot be used together")
+	}
+	overlap := defaultIncrementalOverlap
+	if conf.Fetch.IncrementalOverlap != nil {
+		overlap = *conf.Fetch.IncrementalOverlap
+	}
+
 	log.Debug("Connecting to DB")
 	db, err := connectToDB(conf, log)
 	if err != nil {
@@ -61,11 +122,13 @@ func main() {
 
 	timeframes, limits := getTimeframesAndLimits(fetchAll, conf, log)
 	tradingSymbols := conf.Fetch.TradingSymbols
-	vsCurrency := conf.Fetch.VSCurrency
+	vsCurrencies := conf.QuoteCurrencies()
 	log.Tracef("timeframes: %v", timeframes)
 	log.Tracef("limits: %v", limits)
 	log.Tracef("tradingSymbols: %v", tradingSymbols)
-	log.Tracef("vsCurrency: %v", vsCurrency)
+	log.Tracef("vsCurrencies: %v", vsCurrencies)
+
+	pairs := buildFetchPairs(conf, timeframes, limits, *fetchAll, log)
 
 	const channelSize int = 10
 	downloadChannel := make(chan downloadJob, channelSize)
@@ -73,51 +136,242 @@ func main() {
 	var wg sync.WaitGroup
 	log.Tracef("Creating channels of size %d", channelSize)
 
+	// Cancel in-flight downloads on Ctrl-C, the data fetched so far is still saved
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *repair {
+		client, err := newCryptocompareClient(ctx, conf, log)
+		if err != nil {
+			log.Fatalf("Failed to create cryptocompare client: %v", err)
+		}
+		ledger := startFetchLedger(db, mode, configFile, log)
+		unrepaired := repairGaps(ctx, db, provider.NewCryptoCompare(client), timeframes, ledger, log)
+		ledger.finish(ctx)
+		if len(unrepaired) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	jobTimeout := time.Duration(conf.Fetch.JobTimeoutSeconds) * time.Second
+
 	defer close(downloadChannel)
 	defer close(saveChannel)
 
-	go downloadWorker(downloadChannel, saveChannel, conf.Cryptocompare.APIKey, log)
-	go saveWorker(saveChannel, db, log)
+	p, err := newProvider(ctx, conf, log)
+	if err != nil {
+		log.Fatalf("Failed to create provider: %v", err)
+	}
+	log.Infof("Fetching data from provider %s", p.Name())
+
+	go downloadWorker(ctx, downloadChannel, saveChannel, p, jobTimeout, log)
+	go saveWorker(saveChannel, db, newLake(conf, log), conf.Database.BulkThreshold, log)
+
+	ledger := startFetchLedger(db, mode, configFile, log)
 
-	for _, symbol := range tradingSymbols {
-		for i, timeframe := range timeframes {
-			log.Tracef("Sending download job for %s/%s, timeframe: %s, limit: %d",
-				symbol, vsCurrency, timeframe, limits[i])
+	var jobs []downloadJob
+	if *retryFailed {
+		jobs, err = retryJobs(db, p, &wg, log)
+		if err != nil {
+			log.Fatalf("Failed to get jobs to retry: %v", err)
+		}
+	} else {
+		jobs = pairJobs(pairs, &wg, log)
+	}
 
-			wg.Add(1)
-			downloadChannel <- downloadJob{
+	for _, job := range jobs {
+		if *incremental {
+			job.from = incrementalStart(db, p, job, overlap, log)
+		}
+		job.record = ledger.startJob(job, p, &wg, log)
+
+		wg.Add(1)
+		downloadChannel <- job
+	}
+
+	wg.Wait()
+	ledger.finish(ctx)
+
+	log.Infof("Data fetch completed for symbols: %v, quote currencies: %v", tradingSymbols, vsCurrencies)
+}
+
+// pairJobs returns the download jobs of every timeframe of pairs
+func pairJobs(pairs []*fetchPair, wg *sync.WaitGroup, log *logrus.Logger) []downloadJob {
+	var jobs []downloadJob
+	for _, pair := range pairs {
+		exchange, symbol := config.ParseTradingSymbol(pair.tradingSymbol)
+		for i, timeframe := range pair.timeframes {
+			log.Tracef("Sending download job for %s, timeframe: %s, limit: %d",
+				pairName(exchange, symbol, pair.vsCurrency), timeframe, pair.limits[i])
+
+			jobs = append(jobs, downloadJob{
+				exchange:   exchange,
 				symbol:     symbol,
-				vsCurrency: vsCurrency,
+				vsCurrency: pair.vsCurrency,
 				timeframe:  timeframe,
-				limit:      limits[i],
-				wg:         &wg,
-			}
+				limit:      pair.limits[i],
+				wg:         wg,
+			})
 		}
 	}
+	return jobs
+}
 
-	wg.Wait()
+// fetchMode returns the mode of the run recorded in the ledger, empty if the flags conflict
+func fetchMode(fetchAll, incremental, repair, retryFailed bool) string {
+	modes := map[string]bool{
+		"fetch-all":    fetchAll,
+		"incremental":  incremental,
+		"repair":       repair,
+		"retry-failed": retryFailed,
+	}
 
-	log.Infof("Data fetch completed for symbols: %v", tradingSymbols)
+	mode := "recent"
+	for name, set := range modes {
+		if !set {
+			continue
+		}
+		if mode != "recent" {
+			return ""
+		}
+		mode = name
+	}
+	return mode
 }
 
-// connectToDB connects to the database and returns a db.DB object on success
-func connectToDB(conf *config.Config, log *logrus.Logger) (*db.DB, error) {
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=disable TimeZone=Asia/Taipei",
-		conf.Database.Host, conf.Database.Username, conf.Database.Password, conf.Database.DBName, conf.Database.Port)
+// incrementalStart returns the time an incremental job fetches from, overlap bars before the latest
+// stored bar of the series, or zero to fetch the latest limit bars if the series is empty
+func incrementalStart(db db.Storage, p provider.Provider, job downloadJob, overlap int, log *logrus.Logger) time.Time {
+	repo, err := db.Candles(job.timeframe)
+	if err != nil {
+		log.Errorf("Invalid timeframe: %s", job.timeframe)
+		return time.Time{}
+	}
+
+	latest, err := repo.LatestTimestamp(job.symbol, job.vsCurrency, p.Exchange(job.market()))
+	if err != nil {
+		log.Warnf("Failed to get latest stored %s bar of %s, fetching the latest %d bars, error: %v", job.timeframe, job.pair(), job.limit, err)
+		return time.Time{}
+	}
+	if latest.IsZero() {
+		log.Infof("No %s data of %s stored yet, fetching the latest %d bars", job.timeframe, job.pair(), job.limit)
+		return time.Time{}
+	}
+
+	from := latest.Add(-time.Duration(overlap) * repo.Spec().Interval)
+	log.Debugf("Latest stored %s bar of %s is at %s, fetching from %s", job.timeframe, job.pair(),
+		latest.Format(time.RFC3339), from.Format(time.RFC3339))
+	return from
+}
+
+// connectToDB opens the storage of the configured database driver
+func connectToDB(conf *config.Config, log *logrus.Logger) (db.Storage, error) {
+	dsn := conf.DSN()
 
 	// Mask password in logs
-	log.Trace("DSN: ", strings.Replace(dsn, conf.Database.Password, "***(masked)***", 1))
+	if conf.Database.Password != "" {
+		dsn = strings.Replace(dsn, conf.Database.Password, "***(masked)***", 1)
+	}
+	log.Trace("DSN: ", dsn)
+
+	return db.Open(conf.Database.Driver, conf.DSN(), log, db.WithBatchSize(conf.Database.BatchSize))
+}
+
+// newLake returns the Parquet lake configured in [lake] dir, nil if it is not set
+func newLake(conf *config.Config, log *logrus.Logger) *lake.Lake {
+	if conf.Lake.Dir == "" {
+		return nil
+	}
+	log.Infof("Saving data to the Parquet lake in %s too", conf.Lake.Dir)
+	return lake.New(conf.Lake.Dir)
+}
+
+// newProvider creates the provider configured in [fetch] provider, cryptocompare if not set
+func newProvider(ctx context.Context, conf *config.Config, log *logrus.Logger) (provider.Provider, error) {
+	switch conf.Fetch.Provider {
+	case "", "cryptocompare":
+		client, err := newCryptocompareClient(ctx, conf, log)
+		if err != nil {
+			return nil, err
+		}
+		return provider.NewCryptoCompare(client), nil
+	case "binance":
+		var opts []binance.Option
+		if conf.Binance.BaseURL != "" {
+			opts = append(opts, binance.WithBaseURL(conf.Binance.BaseURL))
+		}
+		if conf.Binance.MaxRetries != nil {
+			opts = append(opts, binance.WithRetry(
+				*conf.Binance.MaxRetries,
+				time.Duration(conf.Binance.RetryBaseDelaySeconds)*time.Second,
+				time.Duration(conf.Binance.RetryMaxDelaySeconds)*time.Second,
+			))
+		}
+		if conf.Binance.RequestsPerMinute > 0 {
+			// all download workers share the limiter of the client
+			limiter := cryptocompare.NewRateLimiter(cryptocompare.RateLimit{PerMinute: conf.Binance.RequestsPerMinute})
+			opts = append(opts, binance.WithRateLimiter(limiter))
+		}
+		return provider.NewBinance(binance.NewClient(log, opts...)), nil
+	default:
+		return nil, fmt.Errorf("unknown provider: %s", conf.Fetch.Provider)
+	}
+}
+
+// newCryptocompareClient creates the cryptocompare client shared by all download jobs, its rate
+// limiter is synced with the calls left of the API key if configured. Syncing is required if a
+// daily or monthly limit is set, it returns an error if the calls left cannot be fetched then.
+func newCryptocompareClient(ctx context.Context, conf *config.Config, log *logrus.Logger) (*cryptocompare.Client, error) {
+	var opts []cryptocompare.Option
+	if conf.Cryptocompare.MaxRetries != nil {
+		opts = append(opts, cryptocompare.WithRetry(
+			*conf.Cryptocompare.MaxRetries,
+			time.Duration(conf.Cryptocompare.RetryBaseDelaySeconds)*time.Second,
+			time.Duration(conf.Cryptocompare.RetryMaxDelaySeconds)*time.Second,
+		))
+	}
+
+	rl := conf.Cryptocompare.RateLimit
+	limit := cryptocompare.RateLimit{
+		PerSecond: rl.PerSecond,
+		PerMinute: rl.PerMinute,
+		PerHour:   rl.PerHour,
+		PerDay:    rl.PerDay,
+		PerMonth:  rl.PerMonth,
+	}
+	if limit == (cryptocompare.RateLimit{}) && !rl.SyncOnStart {
+		log.Debug("Rate limiter disabled")
+		return cryptocompare.NewClient(conf.Cryptocompare.APIKey, log, opts...), nil
+	}
 
-	return db.NewDB(dsn, log)
+	limiter := cryptocompare.NewRateLimiter(limit)
+	opts = append(opts, cryptocompare.WithRateLimiter(limiter))
+	client := cryptocompare.NewClient(conf.Cryptocompare.APIKey, log, opts...)
+
+	if rl.SyncOnStart || limit.NeedsSync() {
+		stats, err := client.FetchRateLimitContext(ctx)
+		switch {
+		case err != nil && limit.NeedsSync():
+			return nil, fmt.Errorf("failed to fetch rate limit stats, required by per_day and per_month: %w", err)
+		case err != nil:
+			log.Warnf("Failed to fetch rate limit stats, using configured limits only, error: %v", err)
+		default:
+			log.Infof("Rate limit calls left: %+v", stats.Data.CallsLeft)
+			limiter.Sync(stats)
+		}
+	}
+
+	return client, nil
 }
 
 // getTimeframesAndLimits returns timeframes and limits when downloading data
-func getTimeframesAndLimits(fetchAll *bool, conf *config.Config, log *logrus.Logger) ([]string, []int) {
+func getTimeframesAndLimits(fetchAll *bool, conf *config.Config, log *logrus.Logger) ([]models.Timeframe, []int) {
 	// timeframes 有三個值，分別是 hourly, daily, minute，用來決定要下載哪個時間區間的資料
 	// 1. 理論上只要 minutes 就可以推算出 hourly 和 daily 的資料
 	//    但是 cryptocompare 的 API 限制 minute 資料只能取最近 7 天
 	// 2. daily 理論上可以由 hourly 推算出來，但是有現成 API 可以用，就不自己算了
-	timeframes := []string{"hourly", "daily", "minute"}
+	timeframes := []models.Timeframe{models.TimeframeHourly, models.TimeframeDaily, models.TimeframeMinute}
 	var limits []int
 	tradingSymbols := conf.Fetch.TradingSymbols
 
@@ -132,134 +386,360 @@ func getTimeframesAndLimits(fetchAll *bool, conf *config.Config, log *logrus.Log
 		limits = []int{conf.Fetch.LimitHourly, conf.Fetch.LimitDaily, conf.Fetch.LimitMinute}
 	}
 
+	// aggregated bar widths are fetched as extra timeframes named after the width, e.g. "15m"
+	for _, aggregate := range conf.Fetch.Aggregates {
+		timeframe, err := registerBarWidth(aggregate)
+		if err != nil {
+			log.Errorf("Skipping aggregated bars %q in config: %v", aggregate, err)
+			continue
+		}
+		timeframes = append(timeframes, timeframe)
+		if *fetchAll {
+			limits = append(limits, -1)
+		} else {
+			limits = append(limits, conf.Fetch.LimitAggregated)
+		}
+	}
+
 	return timeframes, limits
 }
 
-// downloadWorker downloads data from cryptocompare and sends it to saveChannel
-func downloadWorker(downloadChannel chan downloadJob, saveChannel chan saveJob, apiKey string, log *logrus.Logger) {
+// registerBarWidth registers an aggregated bar width like "15m" as a timeframe stored in the aggregated table
+func registerBarWidth(barWidth string) (models.Timeframe, error) {
+	width, err := models.ParseBarWidth(barWidth)
+	if err != nil {
+		return "", err
+	}
+	var history time.Duration
+	if width.Timeframe == models.TimeframeMinute {
+		history = models.MinuteHistory
+	}
+	return models.RegisterAggregatedTimeframe(width.String(), time.Duration(width.Seconds())*time.Second, history), nil
+}
+
+// fetchPair is a trading pair with the timeframes to fetch and their limits
+type fetchPair struct {
+	tradingSymbol string
+	vsCurrency    string
+	timeframes    []models.Timeframe
+	limits        []int
+}
+
+// buildFetchPairs returns every trading symbol paired with every quote currency using the
+// default timeframes and limits, with the [[fetch.pairs]] overrides of config applied
+func buildFetchPairs(conf *config.Config, timeframes []models.Timeframe, limits []int, fetchAll bool, log *logrus.Logger) []*fetchPair {
+	defaultLimits := make(map[models.Timeframe]int, len(timeframes))
+	for i, timeframe := range timeframes {
+		defaultLimits[timeframe] = limits[i]
+	}
+
+	var pairs []*fetchPair
+	for _, tradingSymbol := range conf.Fetch.TradingSymbols {
+		for _, vsCurrency := range conf.QuoteCurrencies() {
+			pairs = append(pairs, &fetchPair{
+				tradingSymbol: tradingSymbol,
+				vsCurrency:    vsCurrency,
+				timeframes:    timeframes,
+				limits:        limits,
+			})
+		}
+	}
+
+	for _, override := range conf.Fetch.Pairs {
+		var matched []*fetchPair
+		for _, pair := range pairs {
+			if pair.tradingSymbol == override.Symbol && (override.VsCurrency == "" || pair.vsCurrency == override.VsCurrency) {
+				matched = append(matched, pair)
+			}
+		}
+		if len(matched) == 0 {
+			if override.VsCurrency == "" {
+				log.Errorf("Skipping [[fetch.pairs]] of %s, vs_currency is required for pairs not in trading_symbols", override.Symbol)
+				continue
+			}
+			pair := &fetchPair{tradingSymbol: override.Symbol, vsCurrency: override.VsCurrency}
+			pairs = append(pairs, pair)
+			matched = append(matched, pair)
+		}
+
+		pairTimeframes := timeframes
+		if len(override.Timeframes) > 0 {
+			pairTimeframes = make([]models.Timeframe, len(override.Timeframes))
+			for i, timeframe := range override.Timeframes {
+				pairTimeframes[i] = models.Timeframe(timeframe)
+			}
+		}
+
+		var pairLimits []int
+		var validTimeframes []models.Timeframe
+		for _, timeframe := range pairTimeframes {
+			limit, ok := defaultLimits[timeframe]
+			if !ok {
+				if _, err := models.LookupTimeframe(timeframe); err != nil {
+					if _, err := registerBarWidth(string(timeframe)); err != nil {
+						log.Errorf("Skipping invalid timeframe %q of [[fetch.pairs]] %s", timeframe, override.Symbol)
+						continue
+					}
+				}
+				limit = conf.Fetch.LimitAggregated
+			}
+			if overrideLimit, ok := override.Limits[string(timeframe)]; ok && !fetchAll {
+				limit = overrideLimit
+			}
+			if fetchAll {
+				limit = -1
+			}
+			validTimeframes = append(validTimeframes, timeframe)
+			pairLimits = append(pairLimits, limit)
+		}
+
+		for _, pair := range matched {
+			pair.timeframes = validTimeframes
+			pair.limits = pairLimits
+		}
+	}
+
+	return pairs
+}
+
+// downloadWorker downloads data from cryptocompare and sends it to saveChannel,
+// each job is aborted when ctx is done or after jobTimeout if it is positive
+func downloadWorker(ctx context.Context, downloadChannel chan downloadJob, saveChannel chan saveJob, p provider.Provider, jobTimeout time.Duration, log *logrus.Logger) {
 	for job := range downloadChannel {
 		func() {
 			defer job.wg.Done()
 
-			log.Infof("Fetching %s data of %s/%s", job.timeframe, job.symbol, job.vsCurrency)
-			var data []cryptocompare.OHLCVData
-			var err error
-
-			client := cryptocompare.NewClient(apiKey, log)
-			fetchAll := job.limit < 0
+			var fetchErr error
+			defer func() { job.record.fetchDone(fetchErr) }()
 
-			funcsFetchAll := map[string]func(string, string) ([]cryptocompare.OHLCVData, error){
-				"hourly": client.FetchAllHourlyOHLCVData,
-				"daily":  client.FetchAllDailyOHLCVData,
-				"minute": client.FetchAllMinuteOHLCVData,
+			jobCtx := ctx
+			if jobTimeout > 0 {
+				var cancel context.CancelFunc
+				jobCtx, cancel = context.WithTimeout(ctx, jobTimeout)
+				defer cancel()
 			}
 
-			funcsFetchLimit := map[string]func(string, string, int) ([]cryptocompare.OHLCVData, error){
-				"hourly": client.FetchHourlyOHLCVData,
-				"daily":  client.FetchDailyOHLCVData,
-				"minute": client.FetchMinuteOHLCVData,
+			if job.limit < 0 {
+				fetchErr = streamAllPages(jobCtx, p, job, saveChannel, log)
+				return
 			}
 
-			if fetchAll {
-				if fetchAllFunc, ok := funcsFetchAll[job.timeframe]; !ok {
-					log.Errorf("Invalid timeframe of fetch all job: %s", job.timeframe)
-					return
-				} else {
-					data, err = fetchAllFunc(job.symbol, job.vsCurrency)
+			var data []provider.Bar
+			var pages int
+			var err error
+			if job.from.IsZero() {
+				log.Infof("Fetching %s data of %s", job.timeframe, job.pair())
+				data, err = p.FetchOHLCV(jobCtx, job.market(), job.timeframe, job.limit)
+				// bars up to the limit are fetched with a single request
+				if data != nil {
+					pages = 1
 				}
 			} else {
-				if fetchLimitFunc, ok := funcsFetchLimit[job.timeframe]; !ok {
-					log.Errorf("Invalid timeframe of fetch limit job: %s", job.timeframe)
-					return
-				} else {
-					data, err = fetchLimitFunc(job.symbol, job.vsCurrency, job.limit)
-				}
+				log.Infof("Fetching %s data of %s since %s", job.timeframe, job.pair(), job.from.Format(time.RFC3339))
+				data, pages, err = p.FetchOHLCVRange(jobCtx, job.market(), job.timeframe, job.from, time.Now())
 			}
+			fetchErr = err
 
 			if data == nil && err != nil {
-				log.Errorf("Failed to fetch %s data of %s/%s, error: %v", job.timeframe, job.symbol, job.vsCurrency, err)
+				logFetchError(job, err, log)
 				return
 			} else if data == nil {
-				log.Errorf("No error returned but data is nil when fetching %s data of %s/%s", job.timeframe, job.symbol, job.vsCurrency)
+				log.Errorf("No error returned but data is nil when fetching %s data of %s", job.timeframe, job.pair())
 			} else if err != nil {
-				log.Warnf("Failed to completely fetch %s data of %s/%s, but we will still save the data we have downloaded, error: %v",
-					job.timeframe, job.symbol, job.vsCurrency, err)
+				log.Warnf("Failed to completely fetch %s data of %s, but we will still save the data we have downloaded, error: %v",
+					job.timeframe, job.pair(), err)
 			} else {
-				log.Infof("Successfully fetched %s data of %s/%s, len: %d", job.timeframe, job.symbol, job.vsCurrency, len(data))
+				log.Infof("Successfully fetched %s data of %s, len: %d", job.timeframe, job.pair(), len(data))
 			}
 
-			if fetchAll {
-				data = removeInvalidOHLCVData(data)
-			}
-
-			log.Tracef("Sending %s data of %s/%s to saveChannel", job.timeframe, job.symbol, job.vsCurrency)
-			job.wg.Add(1)
-			saveChannel <- saveJob{
-				symbol:     job.symbol,
-				vsCurrency: job.vsCurrency,
-				data:       data,
-				timeframe:  job.timeframe,
-				wg:         job.wg,
-			}
+			job.record.fetched(pages, len(data))
+			sendSaveJob(job, p, data, true, saveChannel, log)
 		}()
 	}
 }
 
-// saveWorker gets data from downloadWorker and saves it to DB
-func saveWorker(saveChannel chan saveJob, db *db.DB, log *logrus.Logger) {
+// streamAllPages fetches the whole history of a fetch all job and sends every page to
+// saveChannel as soon as it arrives, so an interrupted backfill keeps the pages downloaded
+// so far. The end of the job is marked by an empty last save job. It returns the error which
+// stopped fetching if any.
+func streamAllPages(ctx context.Context, p provider.Provider, job downloadJob, saveChannel chan saveJob, log *logrus.Logger) error {
+	log.Infof("Fetching all %s data of %s", job.timeframe, job.pair())
+
+	it := p.AllOHLCVPages(ctx, job.market(), job.timeframe)
+	rows, fetchedPages := 0, 0
+	for it.Next() {
+		page := removeInvalidOHLCVData(it.Page())
+		rows += len(page)
+		log.Debugf("Fetched page %d of %s data of %s, len: %d", it.Pages(), job.timeframe, job.pair(), len(page))
+		job.record.fetched(it.Pages()-fetchedPages, len(page))
+		fetchedPages = it.Pages()
+		sendSaveJob(job, p, page, false, saveChannel, log)
+	}
+	if it.Pages() > 0 {
+		sendSaveJob(job, p, nil, true, saveChannel, log)
+	}
+
+	if err := it.Err(); err != nil && it.Pages() == 0 {
+		logFetchError(job, err, log)
+	} else if err != nil {
+		log.Warnf("Failed to completely fetch %s data of %s, %d pages (%d rows) downloaded were sent to save, error: %v",
+			job.timeframe, job.pair(), it.Pages(), rows, err)
+	} else {
+		log.Infof("Successfully fetched all %s data of %s, pages: %d, len: %d", job.timeframe, job.pair(), it.Pages(), rows)
+	}
+	return it.Err()
+}
+
+// sendSaveJob sends data of a download job fetched from p to saveChannel, last is set
+// for the last save job of the download job, whose data may be empty
+func sendSaveJob(job downloadJob, p provider.Provider, data []provider.Bar, last bool, saveChannel chan saveJob, log *logrus.Logger) {
+	log.Tracef("Sending %s data of %s to saveChannel", job.timeframe, job.pair())
+	job.record.saving()
+	job.wg.Add(1)
+	saveChannel <- saveJob{
+		exchange:   p.Exchange(job.market()),
+		provider:   p.Name(),
+		symbol:     job.symbol,
+		vsCurrency: job.vsCurrency,
+		data:       data,
+		timeframe:  job.timeframe,
+		fetchAll:   job.limit < 0,
+		last:       last,
+		record:     job.record,
+		wg:         job.wg,
+	}
+}
+
+// logFetchError logs a failed download job, telling apart errors that may succeed
+// on a later run from errors caused by a wrong config
+func logFetchError(job downloadJob, err error, log *logrus.Logger) {
+	switch {
+	case errors.Is(err, cryptocompare.ErrInvalidAPIKey):
+		log.Errorf("Failed to fetch %s data of %s, check api_key in config, error: %v", job.timeframe, job.pair(), err)
+	case errors.Is(err, cryptocompare.ErrUnknownMarket), errors.Is(err, binance.ErrUnknownMarket):
+		log.Errorf("Failed to fetch %s data of %s, check trading_symbols and vs_currency in config, error: %v", job.timeframe, job.pair(), err)
+	case errors.Is(err, cryptocompare.ErrRateLimited), errors.Is(err, cryptocompare.ErrServerError),
+		errors.Is(err, binance.ErrRateLimited), errors.Is(err, binance.ErrServerError):
+		log.Errorf("Failed to fetch %s data of %s, API is unavailable for now, retry later, error: %v", job.timeframe, job.pair(), err)
+	default:
+		log.Errorf("Failed to fetch %s data of %s, error: %v", job.timeframe, job.pair(), err)
+	}
+}
+
+// saveWorker gets data from downloadWorker and saves it to DB and to the Parquet lake if it is not nil,
+// pages of fetch all jobs with at least bulkThreshold rows are saved with the COPY based bulk loader
+// if bulkThreshold is positive
+func saveWorker(saveChannel chan saveJob, database db.Storage, parquetLake *lake.Lake, bulkThreshold int, log *logrus.Logger) {
+	// downloaded data is still saved after the download is cancelled
+	ctx := context.Background()
+	// the data of each download job is buffered for the lake until its last save job
+	batches := make(map[string]*lake.Batch)
+
 	for job := range saveChannel {
 		func() {
 			defer job.wg.Done()
 
-			log.Infof("Saving %s data of %s/%s", job.timeframe, job.symbol, job.vsCurrency)
+			var result db.UpsertResult
 			var err error
+			defer func() { job.record.saved(result, err) }()
 
-			switch job.timeframe {
-			case "hourly":
-				hourlyOHLCVData := make([]models.CryptoOHLCVHourly, len(job.data))
-				for i, d := range job.data {
-					hourlyOHLCVData[i] = models.CryptoOHLCVHourly{
-						CryptoOHLCV: mapOHLCVData(&d, job.symbol, job.vsCurrency),
-					}
-				}
-				err = db.UpsertHourlyOHLCData(hourlyOHLCVData)
-			case "daily":
-				dailyOHLCVData := make([]models.CryptoOHLCVDaily, len(job.data))
-				for i, d := range job.data {
-					dailyOHLCVData[i] = models.CryptoOHLCVDaily{
-						CryptoOHLCV: mapOHLCVData(&d, job.symbol, job.vsCurrency),
-					}
-				}
-				err = db.UpsertDailyOHLCData(dailyOHLCVData)
-			case "minute":
-				minuteOHLCVData := make([]models.CryptoOHLCVMinute, len(job.data))
-				for i, d := range job.data {
-					minuteOHLCVData[i] = models.CryptoOHLCVMinute{
-						CryptoOHLCV: mapOHLCVData(&d, job.symbol, job.vsCurrency),
-					}
-				}
-				err = db.UpsertMinuteOHLCData(minuteOHLCVData)
-			default:
-				log.Errorf("Invalid timeframe: %s", job.timeframe)
-				return
+			data := make([]models.CryptoOHLCV, len(job.data))
+			for i, d := range job.data {
+				data[i] = mapOHLCVData(&d, job.exchange, job.provider, job.symbol, job.vsCurrency)
 			}
 
-			if err != nil {
-				log.Errorf("Failed to save %s data of %s/%s, error: %v", job.timeframe, job.symbol, job.vsCurrency, err)
-				return
+			// empty data, like the last save job marking the end of a fetch all job, is not saved
+			if len(data) > 0 {
+				result, err = saveToDB(ctx, job, data, database, bulkThreshold, log)
+			}
+			// a failed save to the lake fails the job too, so --retry-failed merges it again,
+			// the rows saved to the database are recorded nonetheless
+			if lakeErr := saveToLake(job, data, parquetLake, batches, log); lakeErr != nil {
+				job.record.failed(lakeErr)
 			}
-
-			log.Infof("Successfully saved %s data of %s/%s", job.timeframe, job.symbol, job.vsCurrency)
 		}()
 	}
 }
 
-// mapOHLCVData maps cryptocompare.OHLCVData to models.CryptoOHLCV
-func mapOHLCVData(src *cryptocompare.OHLCVData, symbol string, vsCurrency string) models.CryptoOHLCV {
+// saveToDB upserts data of job to database
+func saveToDB(ctx context.Context, job saveJob, data []models.CryptoOHLCV, database db.Storage, bulkThreshold int, log *logrus.Logger) (db.UpsertResult, error) {
+	bulk := job.fetchAll && bulkThreshold > 0 && len(data) >= bulkThreshold
+	if bulk {
+		log.Infof("Bulk saving %s data of %s, len: %d", job.timeframe, job.pair(), len(data))
+	} else {
+		log.Infof("Saving %s data of %s", job.timeframe, job.pair())
+	}
+	repo, err := database.Candles(job.timeframe)
+	if err != nil {
+		log.Errorf("Invalid timeframe: %s", job.timeframe)
+		return db.UpsertResult{}, err
+	}
+	// revisions of candles restated upstream are recorded with the fetch run
+	repo = repo.WithRunID(job.record.fetchRunID())
+
+	var result db.UpsertResult
+	if bulk {
+		result, err = repo.BulkUpsert(ctx, data)
+	} else {
+		result, err = repo.Upsert(data)
+	}
+
+	if err != nil {
+		log.Errorf("Failed to save %s data of %s, error: %v", job.timeframe, job.pair(), err)
+		return result, err
+	}
+
+	log.Infof("Successfully saved %s data of %s, %s", job.timeframe, job.pair(), result)
+	return result, nil
+}
+
+// saveToLake adds data of job to the batch of its download job in batches, and merges the batch
+// into parquetLake if job is the last save job. It does nothing if parquetLake is nil.
+func saveToLake(job saveJob, data []models.CryptoOHLCV, parquetLake *lake.Lake, batches map[string]*lake.Batch, log *logrus.Logger) error {
+	if parquetLake == nil {
+		return nil
+	}
+
+	// the pages of a series are saved one download job after another by a single worker
+	series := fmt.Sprintf("%s %s", job.timeframe, job.pair())
+	batch, ok := batches[series]
+	if !ok {
+		batch = parquetLake.Batch(job.timeframe)
+		batches[series] = batch
+	}
+
+	var result lake.MergeResult
+	var err error
+	if len(data) > 0 {
+		result, err = batch.Add(data)
+	}
+	if job.last {
+		delete(batches, series)
+		flushed, flushErr := batch.Flush()
+		result.Add(flushed)
+		if err == nil {
+			err = flushErr
+		}
+	}
+	if err != nil {
+		log.Errorf("Failed to save %s data of %s to the Parquet lake, error: %v", job.timeframe, job.pair(), err)
+		return err
+	}
+
+	if result != (lake.MergeResult{}) {
+		log.Infof("Successfully saved %s data of %s to the Parquet lake, %s", job.timeframe, job.pair(), result)
+	}
+	return nil
+}
+
+// mapOHLCVData maps provider.Bar to models.CryptoOHLCV
+func mapOHLCVData(src *provider.Bar, exchange string, providerName string, symbol string, vsCurrency string) models.CryptoOHLCV {
 	return models.CryptoOHLCV{
 		TradingSymbol: symbol,
 		VsCurrency:    vsCurrency,
-		Timestamp:     time.Unix(src.Time, 0).UTC(),
+		Exchange:      exchange,
+		Provider:      providerName,
+		Timestamp:     src.Time.UTC(),
 		Open:          src.Open,
 		High:          src.High,
 		Low:           src.Low,
@@ -270,7 +750,7 @@ func mapOHLCVData(src *cryptocompare.OHLCVData, symbol string, vsCurrency string
 }
 
 // removeInvalidOHLCVData removes OHLCV data with all zero price values
-func removeInvalidOHLCVData(data []cryptocompare.OHLCVData) []cryptocompare.OHLCVData {
+func removeInvalidOHLCVData(data []provider.Bar) []provider.Bar {
 	zero := decimal.NewFromInt(0)
 
 	for i := len(data) - 1; i >= 0; i-- {
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"crypto_project/config"
+	"crypto_project/pkg/models"
+	"crypto_project/pkg/provider"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchMode(t *testing.T) {
+	tests := []struct {
+		name                                 string
+		fetchAll, incremental, repair, retry bool
+		want                                 string
+	}{
+		{name: "no flag", want: "recent"},
+		{name: "fetch all", fetchAll: true, want: "fetch-all"},
+		{name: "incremental", incremental: true, want: "incremental"},
+		{name: "repair", repair: true, want: "repair"},
+		{name: "retry failed", retry: true, want: "retry-failed"},
+		{name: "fetch all and incremental", fetchAll: true, incremental: true, want: ""},
+		{name: "repair and retry failed", repair: true, retry: true, want: ""},
+		{name: "every flag", fetchAll: true, incremental: true, repair: true, retry: true, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, fetchMode(tt.fetchAll, tt.incremental, tt.repair, tt.retry))
+		})
+	}
+}
+
+func TestBuildFetchPairs(t *testing.T) {
+	const (
+		daily  = models.TimeframeDaily
+		hourly = models.TimeframeHourly
+	)
+	defaults := []models.Timeframe{daily, hourly}
+
+	tests := []struct {
+		name         string
+		symbols      []string
+		vsCurrencies []string
+		pairs        []config.PairConfig
+		fetchAll     bool
+		want         []fetchPair
+	}{
+		{
+			name:         "every symbol with every quote currency",
+			symbols:      []string{"BTC", "Binance:ETH"},
+			vsCurrencies: []string{"USD", "EUR"},
+			want: []fetchPair{
+				{"BTC", "USD", defaults, []int{30, 24}},
+				{"BTC", "EUR", defaults, []int{30, 24}},
+				{"Binance:ETH", "USD", defaults, []int{30, 24}},
+				{"Binance:ETH", "EUR", defaults, []int{30, 24}},
+			},
+		},
+		{
+			name:         "timeframes and limits of every quote currency",
+			symbols:      []string{"BTC", "ETH"},
+			vsCurrencies: []string{"USD", "EUR"},
+			pairs: []config.PairConfig{
+				{Symbol: "BTC", Timeframes: []string{"hourly", "15m"}, Limits: map[string]int{"hourly": 48}},
+			},
+			want: []fetchPair{
+				{"BTC", "USD", []models.Timeframe{hourly, "15m"}, []int{48, 100}},
+				{"BTC", "EUR", []models.Timeframe{hourly, "15m"}, []int{48, 100}},
+				{"ETH", "USD", defaults, []int{30, 24}},
+				{"ETH", "EUR", defaults, []int{30, 24}},
+			},
+		},
+		{
+			name:         "limits of one quote currency of an exchange-qualified symbol",
+			symbols:      []string{"Binance:ETH"},
+			vsCurrencies: []string{"USD", "EUR"},
+			pairs: []config.PairConfig{
+				{Symbol: "Binance:ETH", VsCurrency: "USD", Limits: map[string]int{"daily": 7}},
+			},
+			want: []fetchPair{
+				{"Binance:ETH", "USD", defaults, []int{7, 24}},
+				{"Binance:ETH", "EUR", defaults, []int{30, 24}},
+			},
+		},
+		{
+			name:         "pairs not in trading symbols",
+			symbols:      []string{"BTC"},
+			vsCurrencies: []string{"USD"},
+			pairs: []config.PairConfig{
+				{Symbol: "Kraken:SOL", VsCurrency: "EUR", Timeframes: []string{"daily"}},
+				{Symbol: "DOGE"},
+			},
+			want: []fetchPair{
+				{"BTC", "USD", defaults, []int{30, 24}},
+				{"Kraken:SOL", "EUR", []models.Timeframe{daily}, []int{30}},
+			},
+		},
+		{
+			name:         "invalid timeframes are skipped",
+			symbols:      []string{"BTC"},
+			vsCurrencies: []string{"USD"},
+			pairs: []config.PairConfig{
+				{Symbol: "BTC", Timeframes: []string{"weekly", "hourly"}},
+			},
+			want: []fetchPair{
+				{"BTC", "USD", []models.Timeframe{hourly}, []int{24}},
+			},
+		},
+		{
+			name:         "fetch all ignores limits",
+			symbols:      []string{"BTC"},
+			vsCurrencies: []string{"USD"},
+			pairs: []config.PairConfig{
+				{Symbol: "BTC", Timeframes: []string{"hourly", "4h"}, Limits: map[string]int{"hourly": 48}},
+			},
+			fetchAll: true,
+			want: []fetchPair{
+				{"BTC", "USD", []models.Timeframe{hourly, "4h"}, []int{-1, -1}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := &config.Config{}
+			conf.Fetch.TradingSymbols = tt.symbols
+			conf.Fetch.VSCurrencies = tt.vsCurrencies
+			conf.Fetch.Pairs = tt.pairs
+			conf.Fetch.LimitAggregated = 100
+
+			limits := []int{30, 24}
+			if tt.fetchAll {
+				limits = []int{-1, -1}
+			}
+
+			var got []fetchPair
+			for _, pair := range buildFetchPairs(conf, defaults, limits, tt.fetchAll, discardLogger()) {
+				got = append(got, *pair)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestPairJobs(t *testing.T) {
+	pairs := []*fetchPair{
+		{"Binance:ETH", "USDT", []models.Timeframe{models.TimeframeDaily, models.TimeframeHourly}, []int{30, 24}},
+		{"BTC", "USD", []models.Timeframe{models.TimeframeHourly}, []int{-1}},
+	}
+
+	jobs := pairJobs(pairs, nil, discardLogger())
+	assert.Equal(t, []downloadJob{
+		{exchange: "Binance", symbol: "ETH", vsCurrency: "USDT", timeframe: models.TimeframeDaily, limit: 30},
+		{exchange: "Binance", symbol: "ETH", vsCurrency: "USDT", timeframe: models.TimeframeHourly, limit: 24},
+		{symbol: "BTC", vsCurrency: "USD", timeframe: models.TimeframeHourly, limit: -1},
+	}, jobs)
+}
+
+// pagesProvider serves pages of bars through AllOHLCVPages, the other methods are not implemented
+type pagesProvider struct {
+	provider.Provider
+	it *pageIterator
+}
+
+func (p *pagesProvider) Name() string                    { return "test" }
+func (p *pagesProvider) Exchange(provider.Market) string { return models.DefaultExchange }
+func (p *pagesProvider) AllOHLCVPages(context.Context, provider.Market, models.Timeframe) provider.PageIterator {
+	return p.it
+}
+
+// pageIterator returns pages, then stops with err, next is called before each page is fetched
+type pageIterator struct {
+	pages [][]provider.Bar
+	err   error
+	next  func(fetched int)
+	n     int
+}
+
+func (it *pageIterator) Next() bool {
+	it.next(it.n)
+	if it.n == len(it.pages) {
+		return false
+	}
+	it.n++
+	return true
+}
+
+func (it *pageIterator) Page() []provider.Bar { return it.pages[it.n-1] }
+func (it *pageIterator) Pages() int           { return it.n }
+func (it *pageIterator) Err() error           { return it.err }
+
+func TestStreamAllPages(t *testing.T) {
+	bar := func(hour int) provider.Bar {
+		return provider.Bar{Time: time.Unix(int64(hour)*3600, 0), Close: decimal.NewFromInt(1), VolumeFrom: decimal.NewFromInt(1)}
+	}
+	boom := errors.New("boom")
+
+	tests := []struct {
+		name  string
+		pages [][]provider.Bar
+		err   error
+		want  []int
+	}{
+		{name: "every page", pages: [][]provider.Bar{{bar(3), bar(4)}, {bar(1), bar(2)}, {bar(0)}}, want: []int{2, 2, 1, 0}},
+		{name: "interrupted", pages: [][]provider.Bar{{bar(3), bar(4)}}, err: boom, want: []int{2, 0}},
+		{name: "nothing fetched", err: boom},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saveChannel := make(chan saveJob, len(tt.pages)+1)
+			it := &pageIterator{pages: tt.pages, err: tt.err, next: func(fetched int) {
+				assert.Len(t, saveChannel, fetched, "pages are sent before the next one is fetched")
+			}}
+
+			var wg sync.WaitGroup
+			job := downloadJob{symbol: "BTC", vsCurrency: "USD", timeframe: models.TimeframeHourly, limit: -1, wg: &wg}
+			err := streamAllPages(context.Background(), &pagesProvider{it: it}, job, saveChannel, discardLogger())
+			assert.Equal(t, tt.err, err)
+			close(saveChannel)
+
+			var lens []int
+			for saved := range saveChannel {
+				lens = append(lens, len(saved.data))
+				assert.Equal(t, len(lens) == len(tt.want), saved.last, "only the empty save job ending the job is last")
+				assert.True(t, saved.fetchAll)
+				wg.Done()
+			}
+			assert.Equal(t, tt.want, lens)
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"crypto_project/pkg/db"
+	"crypto_project/pkg/models"
+	"crypto_project/pkg/provider"
+
+	"github.com/sirupsen/logrus"
+)
+
+// fetchLedger records a run and its download jobs in fetch_runs and fetch_jobs
+type fetchLedger struct {
+	db  db.Storage
+	run *models.FetchRun
+	log *logrus.Logger
+
+	mu sync.Mutex
+	// statuses counts the jobs of the run by final status
+	statuses map[string]int
+}
+
+// jobRecord aggregates the outcome of a download job and of the save jobs of its data, the job
+// is finished when the download and every save are done. It is recorded in the ledger if the run is.
+type jobRecord struct {
+	// name identifies the job in logs
+	name string
+	log  *logrus.Logger
+	// db is nil if the job is not recorded in the ledger
+	db    db.Storage
+	id    int64
+	runID int64
+
+	// pending is the download and the save jobs not done yet
+	pending sync.WaitGroup
+
+	mu          sync.Mutex
+	rowsFetched int
+	saveResult  db.UpsertResult
+	fetchErr    error
+	saveErr     error
+}
+
+// startFetchLedger records the start of a run, it returns nil if the run cannot be recorded
+// so fetching is not stopped by the ledger
+func startFetchLedger(database db.Storage, mode string, configFile string, log *logrus.Logger) *fetchLedger {
+	hash, err := configHash(configFile)
+	if err != nil {
+		log.Warnf("Failed to hash config, error: %v", err)
+	}
+
+	run, err := database.StartFetchRun(mode, hash)
+	if err != nil {
+		log.Warnf("Fetch run is not recorded in the ledger, error: %v", err)
+		return nil
+	}
+	log.Infof("Started fetch run %d", run.ID)
+	return &fetchLedger{db: database, run: run, log: log, statuses: make(map[string]int)}
+}
+
+// configHash returns the SHA-256 of the config file
+func configHash(configFile string) (string, error) {
+	content, err := os.ReadFile(configFile)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// startJob starts aggregating the outcome of a download job, which is recorded in the ledger
+// unless l is nil. The job is finished by a goroutine which wg waits for.
+func (l *fetchLedger) startJob(job downloadJob, p provider.Provider, wg *sync.WaitGroup, log *logrus.Logger) *jobRecord {
+	record := &jobRecord{name: fmt.Sprintf("%s job of %s", job.timeframe, job.pair()), log: log}
+	if l != nil {
+		row := &models.FetchJob{
+			RunID:         l.run.ID,
+			TradingSymbol: job.symbol,
+			VsCurrency:    job.vsCurrency,
+			Exchange:      p.Exchange(job.market()),
+			Provider:      p.Name(),
+			Timeframe:     job.timeframe,
+			Limit:         job.limit,
+		}
+		if !job.from.IsZero() {
+			row.Since = &job.from
+		}
+		if err := l.db.StartFetchJob(row); err == nil {
+			record.db, record.id, record.runID = l.db, row.ID, l.run.ID
+		}
+	}
+	// the download job
+	record.pending.Add(1)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		record.pending.Wait()
+		status := record.finish()
+
+		if l != nil {
+			l.mu.Lock()
+			l.statuses[status]++
+			l.mu.Unlock()
+		}
+	}()
+	return record
+}
+
+// finish records the end of the run once every job has finished
+func (l *fetchLedger) finish(ctx context.Context) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	total := 0
+	for _, n := range l.statuses {
+		total += n
+	}
+
+	status := models.FetchStatusSucceeded
+	var errMsg string
+	switch {
+	case ctx.Err() != nil:
+		status = models.FetchStatusCancelled
+		errMsg = ctx.Err().Error()
+	case l.statuses[models.FetchStatusFailed] > 0:
+		status = models.FetchStatusFailed
+		errMsg = fmt.Sprintf("%d of %d jobs failed", l.statuses[models.FetchStatusFailed], total)
+	case l.statuses[models.FetchStatusPartial] > 0 || l.statuses[models.FetchStatusCancelled] > 0:
+		status = models.FetchStatusPartial
+		errMsg = fmt.Sprintf("%d of %d jobs fetched partial data",
+			l.statuses[models.FetchStatusPartial]+l.statuses[models.FetchStatusCancelled], total)
+	}
+
+	if err := l.db.FinishFetchRun(l.run, status, errMsg); err == nil {
+		l.log.Infof("Finished fetch run %d, status: %s, jobs: %v", l.run.ID, status, l.statuses)
+	}
+}
+
+// fetchRunID returns the ID of the fetch run of the job, 0 if it is not recorded in the ledger
+func (r *jobRecord) fetchRunID() int64 {
+	if r == nil {
+		return 0
+	}
+	return r.runID
+}
+
+// fetched records pages and rows fetched by the download job
+func (r *jobRecord) fetched(pages int, rows int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.rowsFetched += rows
+	r.mu.Unlock()
+	if r.db != nil {
+		r.db.AddFetchJobProgress(r.id, pages, rows, db.UpsertResult{})
+	}
+}
+
+// fetchDone records the end of the download job, err is the error which stopped it if any
+func (r *jobRecord) fetchDone(err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.fetchErr = err
+	r.mu.Unlock()
+	r.pending.Done()
+}
+
+// saving records that data of the job has been sent to be saved
+func (r *jobRecord) saving() {
+	if r == nil {
+		return
+	}
+	r.pending.Add(1)
+}
+
+// failed records an error of a save job which did not keep its data from being saved to the
+// database, it fails the job. It must be called before saved.
+func (r *jobRecord) failed(err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	if r.saveErr == nil {
+		r.saveErr = err
+	}
+	r.mu.Unlock()
+}
+
+// saved records the end of a save job of the data of the job
+func (r *jobRecord) saved(result db.UpsertResult, err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	if err != nil && r.saveErr == nil {
+		r.saveErr = err
+	}
+	r.saveResult.Add(result)
+	r.mu.Unlock()
+	if err == nil && r.db != nil {
+		r.db.AddFetchJobProgress(r.id, 0, 0, result)
+	}
+	r.pending.Done()
+}
+
+// finish records the end of the job and logs its totals, it returns the status of the job
+func (r *jobRecord) finish() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	status := models.FetchStatusSucceeded
+	var errMsg string
+	switch {
+	case r.saveErr != nil:
+		status = models.FetchStatusFailed
+		errMsg = r.saveErr.Error()
+	case r.fetchErr != nil && r.rowsFetched == 0:
+		status = models.FetchStatusFailed
+		errMsg = r.fetchErr.Error()
+	case errors.Is(r.fetchErr, context.Canceled):
+		status = models.FetchStatusCancelled
+		errMsg = r.fetchErr.Error()
+	case r.fetchErr != nil:
+		status = models.FetchStatusPartial
+		errMsg = r.fetchErr.Error()
+	}
+
+	if r.db != nil {
+		r.db.FinishFetchJob(r.id, status, errMsg)
+	}
+	r.log.Infof("Finished %s, status: %s, fetched: %d, %s", r.name, status, r.rowsFetched, r.saveResult)
+	return status
+}
+
+// retryJobs returns download jobs retrying the jobs of the latest run which did not succeed
+func retryJobs(database db.Storage, p provider.Provider, wg *sync.WaitGroup, log *logrus.Logger) ([]downloadJob, error) {
+	run, err := database.LatestFetchRun()
+	if err != nil {
+		return nil, err
+	}
+	if run == nil {
+		return nil, errors.New("no fetch run recorded yet")
+	}
+
+	rows, err := database.UnsuccessfulFetchJobs(run.ID)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Retrying %d jobs of fetch run %d", len(rows), run.ID)
+
+	var jobs []downloadJob
+	for _, row := range rows {
+		if row.Provider != p.Name() {
+			log.Warnf("Skipping %s job of %s fetched from provider %s, the configured provider is %s",
+				row.Timeframe, pairName(row.Exchange, row.TradingSymbol, row.VsCurrency), row.Provider, p.Name())
+			continue
+		}
+		if _, err := models.LookupTimeframe(row.Timeframe); err != nil {
+			if _, err := registerBarWidth(string(row.Timeframe)); err != nil {
+				log.Errorf("Skipping job with invalid timeframe: %s", row.Timeframe)
+				continue
+			}
+		}
+
+		job := downloadJob{
+			exchange:   row.Exchange,
+			symbol:     row.TradingSymbol,
+			vsCurrency: row.VsCurrency,
+			timeframe:  row.Timeframe,
+			limit:      row.Limit,
+			wg:         wg,
+		}
+		if row.Since != nil {
+			job.from = *row.Since
+		}
+		// the exchange the provider picks by default is not passed as exchange
+		if row.Exchange == p.Exchange(provider.Market{Symbol: row.TradingSymbol, VsCurrency: row.VsCurrency}) {
+			job.exchange = ""
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"crypto_project/pkg/db"
+	"crypto_project/pkg/models"
+	"crypto_project/pkg/provider"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func discardLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.Out = io.Discard
+	return logger
+}
+
+func newSQLiteDB(t *testing.T) *db.SQLiteDB {
+	t.Helper()
+	database, err := db.NewSQLiteDB(":memory:", discardLogger())
+	require.NoError(t, err)
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+func TestJobRecordFinish(t *testing.T) {
+	boom := errors.New("boom")
+	tests := []struct {
+		name        string
+		rowsFetched int
+		fetchErr    error
+		saveErr     error
+		want        string
+	}{
+		{name: "succeeded", rowsFetched: 10, want: models.FetchStatusSucceeded},
+		{name: "nothing to fetch", want: models.FetchStatusSucceeded},
+		{name: "save failed", rowsFetched: 10, saveErr: boom, want: models.FetchStatusFailed},
+		{name: "save failed after partial fetch", rowsFetched: 10, fetchErr: boom, saveErr: boom, want: models.FetchStatusFailed},
+		{name: "nothing fetched", fetchErr: boom, want: models.FetchStatusFailed},
+		{name: "partial fetch", rowsFetched: 10, fetchErr: boom, want: models.FetchStatusPartial},
+		{name: "cancelled", rowsFetched: 10, fetchErr: context.Canceled, want: models.FetchStatusCancelled},
+		{name: "cancelled before fetching", fetchErr: context.Canceled, want: models.FetchStatusFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := &jobRecord{name: tt.name, log: discardLogger(),
+				rowsFetched: tt.rowsFetched, fetchErr: tt.fetchErr, saveErr: tt.saveErr}
+			assert.Equal(t, tt.want, record.finish())
+		})
+	}
+}
+
+func TestJobRecordPending(t *testing.T) {
+	database := newSQLiteDB(t)
+	log := discardLogger()
+	p := provider.NewCryptoCompare(nil)
+
+	ledger := startFetchLedger(database, "recent", "", log)
+	require.NotNil(t, ledger)
+
+	var wg sync.WaitGroup
+	job := downloadJob{symbol: "BTC", vsCurrency: "USD", timeframe: models.TimeframeHourly, limit: 24}
+	record := ledger.startJob(job, p, &wg, log)
+
+	// the job is finished by the last save, which ends after the download
+	record.fetched(1, 24)
+	record.saving()
+	record.fetchDone(nil)
+	record.saved(db.UpsertResult{Inserted: 20, Unchanged: 4}, nil)
+	wg.Wait()
+	ledger.finish(context.Background())
+
+	run, err := database.LatestFetchRun()
+	require.NoError(t, err)
+	assert.Equal(t, models.FetchStatusSucceeded, run.Status)
+	last, err := database.LastSuccessfulFetchJob("BTC", "USD", models.DefaultExchange, models.TimeframeHourly)
+	require.NoError(t, err)
+	require.NotNil(t, last)
+	assert.Equal(t, 1, last.Pages)
+	assert.Equal(t, 24, last.RowsFetched)
+	assert.Equal(t, 20, last.RowsInserted)
+	assert.Equal(t, 4, last.RowsUnchanged)
+}
+
+func TestRetryJobs(t *testing.T) {
+	database := newSQLiteDB(t)
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	run, err := database.StartFetchRun("recent", "")
+	require.NoError(t, err)
+	for _, row := range []struct {
+		job    models.FetchJob
+		status string
+	}{
+		{models.FetchJob{TradingSymbol: "BTC", VsCurrency: "USD", Exchange: models.DefaultExchange,
+			Provider: "cryptocompare", Timeframe: models.TimeframeHourly, Limit: 24}, models.FetchStatusFailed},
+		{models.FetchJob{TradingSymbol: "ETH", VsCurrency: "USD", Exchange: "Binance",
+			Provider: "cryptocompare", Timeframe: models.TimeframeMinute, Since: &since}, models.FetchStatusPartial},
+		{models.FetchJob{TradingSymbol: "BTC", VsCurrency: "USDT", Exchange: "Binance",
+			Provider: "binance", Timeframe: models.TimeframeHourly, Limit: 24}, models.FetchStatusFailed},
+		{models.FetchJob{TradingSymbol: "BTC", VsCurrency: "USD", Exchange: models.DefaultExchange,
+			Provider: "cryptocompare", Timeframe: "weekly", Limit: 24}, models.FetchStatusFailed},
+		{models.FetchJob{TradingSymbol: "BTC", VsCurrency: "USD", Exchange: models.DefaultExchange,
+			Provider: "cryptocompare", Timeframe: models.TimeframeDaily, Limit: 24}, models.FetchStatusSucceeded},
+	} {
+		row.job.RunID = run.ID
+		require.NoError(t, database.StartFetchJob(&row.job))
+		require.NoError(t, database.FinishFetchJob(row.job.ID, row.status, ""))
+	}
+	require.NoError(t, database.FinishFetchRun(run, models.FetchStatusFailed, ""))
+
+	var wg sync.WaitGroup
+	jobs, err := retryJobs(database, provider.NewCryptoCompare(nil), &wg, discardLogger())
+	require.NoError(t, err)
+	require.Len(t, jobs, 2, "jobs of other providers, with invalid timeframes or which succeeded are not retried")
+
+	assert.Equal(t, "", jobs[0].exchange, "the default exchange of the provider is not passed")
+	assert.Equal(t, "BTC", jobs[0].symbol)
+	assert.Equal(t, models.TimeframeHourly, jobs[0].timeframe)
+	assert.Equal(t, 24, jobs[0].limit)
+	assert.True(t, jobs[0].from.IsZero())
+
+	assert.Equal(t, "Binance", jobs[1].exchange)
+	assert.Equal(t, "ETH", jobs[1].symbol)
+	assert.Equal(t, models.TimeframeMinute, jobs[1].timeframe)
+	assert.True(t, jobs[1].from.Equal(since), "incremental jobs fetch from the same time again")
+	assert.Same(t, &wg, jobs[1].wg)
+}
+
+func TestRetryJobsWithoutRun(t *testing.T) {
+	var wg sync.WaitGroup
+	_, err := retryJobs(newSQLiteDB(t), provider.NewCryptoCompare(nil), &wg, discardLogger())
+	assert.Error(t, err)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"crypto_project/pkg/db"
+	"crypto_project/pkg/models"
+	"crypto_project/pkg/provider"
+
+	"github.com/sirupsen/logrus"
+)
+
+// unrepairedGap is a gap which is still missing after repairing
+type unrepairedGap struct {
+	timeframe models.Timeframe
+	series    db.Series
+	gap       db.Gap
+	reason    string
+}
+
+func (u unrepairedGap) String() string {
+	// series is not set if the series of the timeframe could not be listed
+	if u.series.TradingSymbol == "" {
+		return fmt.Sprintf("%s data, %s", u.timeframe, u.reason)
+	}
+	return fmt.Sprintf("%s %s data: %s to %s, %d bars missing, %s",
+		pairName(u.series.Exchange, u.series.TradingSymbol, u.series.VsCurrency), u.timeframe,
+		u.gap.Start.Format(time.RFC3339), u.gap.End.Format(time.RFC3339), u.gap.Missing, u.reason)
+}
+
+// repairGaps scans every stored series of the timeframes for gaps between its first and last bar,
+// fetches the missing bars from p and saves them. The fetch of each gap is recorded as a job of
+// ledger unless it is nil. It returns the gaps it could not repair, including the series which
+// could not be scanned.
+func repairGaps(ctx context.Context, database db.Storage, p provider.Provider, timeframes []models.Timeframe, ledger *fetchLedger, log *logrus.Logger) []unrepairedGap {
+	var unrepaired []unrepairedGap
+	missing, repaired := 0, 0
+
+	// waits for the jobs of the gaps to be finished
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for _, timeframe := range timeframes {
+		repo, err := database.Candles(timeframe)
+		if err != nil {
+			log.Errorf("Invalid timeframe: %s", timeframe)
+			continue
+		}
+		series, err := repo.Series()
+		if err != nil {
+			log.Errorf("Failed to list the series of %s data, error: %v", timeframe, err)
+			unrepaired = append(unrepaired, unrepairedGap{timeframe: timeframe,
+				reason: fmt.Sprintf("failed to list the series: %v", err)})
+			continue
+		}
+
+		for _, s := range series {
+			if ctx.Err() != nil {
+				log.Warnf("Repair cancelled, error: %v", ctx.Err())
+				return unrepaired
+			}
+
+			interval := repo.Spec().Interval
+			gaps, err := repo.Gaps(s.TradingSymbol, s.VsCurrency, s.Exchange, s.First, s.Last.Add(interval))
+			if err != nil {
+				log.Errorf("Failed to scan %s data of %s for gaps, error: %v",
+					timeframe, pairName(s.Exchange, s.TradingSymbol, s.VsCurrency), err)
+				unrepaired = append(unrepaired, unrepairedGap{timeframe: timeframe, series: s,
+					gap: db.Gap{Start: s.First, End: s.Last.Add(interval)}, reason: fmt.Sprintf("failed to scan for gaps: %v", err)})
+				continue
+			}
+
+			for _, gap := range gaps {
+				left := repairGap(ctx, repo, p, s, gap, ledger, &wg, log)
+				missing += gap.Missing
+				repaired += gap.Missing
+				for _, u := range left {
+					repaired -= u.gap.Missing
+				}
+				unrepaired = append(unrepaired, left...)
+			}
+		}
+	}
+
+	for _, u := range unrepaired {
+		log.Warnf("Unrepaired gap of %s", u)
+	}
+	log.Infof("Repair completed, repaired %d of %d missing bars, %d gaps left", repaired, missing, len(unrepaired))
+	return unrepaired
+}
+
+// repairGap fetches and saves the bars of one gap as a job of ledger, then scans the gap again and
+// returns what is still missing. The job is finished by a goroutine which wg waits for.
+func repairGap(ctx context.Context, repo db.CandleStore, p provider.Provider, s db.Series, gap db.Gap, ledger *fetchLedger, wg *sync.WaitGroup, log *logrus.Logger) []unrepairedGap {
+	spec := repo.Spec()
+	unrepaired := func(gap db.Gap, reason string) unrepairedGap {
+		return unrepairedGap{timeframe: spec.Timeframe, series: s, gap: gap, reason: reason}
+	}
+
+	// bars older than the API history, e.g. minute bars older than 7 days, cannot be fetched again
+	start := gap.Start
+	var result []unrepairedGap
+	if cutoff := spec.AvailableSince(time.Now()); start.Before(cutoff) {
+		if !gap.End.After(cutoff) {
+			return []unrepairedGap{unrepaired(gap, "older than the history served by the API")}
+		}
+		start = cutoff.Truncate(spec.Interval)
+		if start.Before(cutoff) {
+			start = start.Add(spec.Interval)
+		}
+		old := db.Gap{Start: gap.Start, End: start, Missing: int(start.Sub(gap.Start) / spec.Interval)}
+		result = append(result, unrepaired(old, "older than the history served by the API"))
+		gap = db.Gap{Start: start, End: gap.End, Missing: gap.Missing - old.Missing}
+	}
+
+	market := provider.Market{Symbol: s.TradingSymbol, VsCurrency: s.VsCurrency}
+	if s.Exchange != models.DefaultExchange {
+		market.Exchange = s.Exchange
+	}
+	pair := pairName(market.Exchange, s.TradingSymbol, s.VsCurrency)
+
+	job := downloadJob{exchange: market.Exchange, symbol: s.TradingSymbol, vsCurrency: s.VsCurrency,
+		timeframe: spec.Timeframe, limit: gap.Missing, from: start}
+	record := ledger.startJob(job, p, wg, log)
+
+	log.Infof("Repairing %s data of %s from %s to %s", spec.Timeframe, pair, start.Format(time.RFC3339), gap.End.Format(time.RFC3339))
+	bars, pages, err := p.FetchOHLCVRange(ctx, market, spec.Timeframe, start, gap.End)
+	if err != nil {
+		log.Errorf("Failed to fetch %s data of %s to repair, error: %v", spec.Timeframe, pair, err)
+	}
+
+	bars = removeInvalidOHLCVData(bars)
+	record.fetched(pages, len(bars))
+	record.saving()
+	record.fetchDone(err)
+
+	data := make([]models.CryptoOHLCV, len(bars))
+	for i, b := range bars {
+		data[i] = mapOHLCVData(&b, p.Exchange(market), p.Name(), s.TradingSymbol, s.VsCurrency)
+	}
+	saved, err := repo.WithRunID(record.fetchRunID()).Upsert(data)
+	if err != nil {
+		log.Errorf("Failed to save %s data of %s to repair, error: %v", spec.Timeframe, pair, err)
+	} else {
+		log.Infof("Saved %s data of %s to repair, %s", spec.Timeframe, pair, saved)
+	}
+	record.saved(saved, err)
+
+	left, err := repo.Gaps(s.TradingSymbol, s.VsCurrency, s.Exchange, start, gap.End)
+	if err != nil {
+		return append(result, unrepaired(gap, "failed to scan the gap again"))
+	}
+	for _, g := range left {
+		result = append(result, unrepaired(g, "not served by the API"))
+	}
+	return result
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"crypto_project/config"
+	"crypto_project/pkg/db"
+
+	"github.com/sirupsen/logrus"
+)
+
+const usage = `Usage: migrate [flags] up|down [steps]|status
+
+  up      apply all pending migrations, then set up TimescaleDB if storage is "timescale"
+          or partition the candle tables by month if storage is "partitioned"
+  down    revert the last steps applied migrations, 1 if not set, TimescaleDB and
+          partitioning set up by up are not reverted
+  status  list migrations and whether they have been applied, and how the candle tables are stored
+`
+
+func main() {
+	configFile := flag.String("config", "config.toml", "Config file")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	log := logrus.New()
+	log.Out = os.Stdout
+	log.Level = logrus.InfoLevel
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	conf, err := config.ReadConfig(*configFile)
+	if err != nil {
+		log.Fatalf("Error reading config: %v", err)
+	}
+
+	if conf.Database.Driver == db.DriverSQLite {
+		log.Fatalf("Migrations need PostgreSQL, the SQLite schema is created when the database is opened, driver: %s", conf.Database.Driver)
+	}
+
+	database, err := db.NewDB(conf.DSN(), log, db.WithoutSchemaCheck())
+	if err != nil {
+		log.Fatalf("Failed to connect to DB: %v", err)
+	}
+
+	storage := conf.Database.Storage
+	switch storage {
+	case "":
+		storage = db.StoragePostgres
+	case db.StoragePostgres, db.StorageTimescale, db.StoragePartitioned:
+	default:
+		log.Fatalf("Invalid storage: %s", conf.Database.Storage)
+	}
+
+	switch flag.Arg(0) {
+	case "up":
+		applied, err := database.MigrateUp()
+		if err != nil {
+			log.Fatalf("Migrating up failed after %d migrations: %v", applied, err)
+		}
+		log.Infof("Applied %d migrations", applied)
+
+		switch storage {
+		case db.StorageTimescale:
+			if err := database.SetupTimescale(); err != nil {
+				log.Fatalf("Setting up TimescaleDB failed: %v", err)
+			}
+			log.Infof("TimescaleDB hypertables and continuous aggregates are set up")
+		case db.StoragePartitioned:
+			if err := database.SetupPartitioning(db.MonthsAhead(conf.Database.Partitions.MonthsAhead), time.Now()); err != nil {
+				log.Fatalf("Partitioning tables failed: %v", err)
+			}
+			log.Infof("Candle tables are partitioned by month")
+		}
+	case "down":
+		steps := 1
+		if flag.NArg() > 1 {
+			steps, err = strconv.Atoi(flag.Arg(1))
+			if err != nil || steps < 1 {
+				log.Fatalf("Invalid steps: %s", flag.Arg(1))
+			}
+		}
+		if mode, err := database.StorageMode(); err == nil && mode != db.StoragePostgres {
+			log.Warnf("Candle tables are stored as %s, which migrating down does not revert", mode)
+		}
+		reverted, err := database.MigrateDown(steps)
+		if err != nil {
+			log.Fatalf("Migrating down failed after %d migrations: %v", reverted, err)
+		}
+		log.Infof("Reverted %d migrations", reverted)
+	case "status":
+		status, err := database.MigrationStatus()
+		if err != nil {
+			log.Fatalf("Failed to get migration status: %v", err)
+		}
+		mode, err := database.StorageMode()
+		if err != nil {
+			log.Fatalf("Failed to get storage mode: %v", err)
+		}
+		printStatus(status, mode, storage)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+// printStatus prints a table of the migrations and when they have been applied, followed by the
+// storage mode of the candle tables, which migrate up sets up outside of the migrations
+func printStatus(status []db.MigrationStatus, mode string, configured string) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, s := range status {
+		appliedAt := "pending"
+		if s.Applied {
+			appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05 MST")
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+	}
+	w.Flush()
+
+	fmt.Printf("\nStorage: %s\n", mode)
+	if mode != configured {
+		fmt.Printf("Storage in config is %s, run migrate up to set it up\n", configured)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"crypto_project/config"
+	"crypto_project/pkg/archive"
+	"crypto_project/pkg/db"
+	"crypto_project/pkg/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+const usage = `Usage: partitions [flags] maintain|status
+
+  maintain  create the partitions of the coming months and of candles in the default partitions,
+            detach the partitions older than the retention of their timeframe, then archive the
+            candles of detached partitions into retention.archive_dir and drop them
+  status    list the partitions of the candle tables
+`
+
+func main() {
+	configFile := flag.String("config", "config.toml", "Config file")
+	batchSize := flag.Int("batch-size", 10000, "Candles of a detached partition archived per query")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	log := logrus.New()
+	log.Out = os.Stdout
+	log.Level = logrus.InfoLevel
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	conf, err := config.ReadConfig(*configFile)
+	if err != nil {
+		log.Fatalf("Error reading config: %v", err)
+	}
+	if conf.Database.Driver == db.DriverSQLite {
+		log.Fatalf("Partitioning needs PostgreSQL, driver: %s", conf.Database.Driver)
+	}
+	if conf.Database.Storage != "partitioned" {
+		log.Fatalf("Candle tables are partitioned only if storage is \"partitioned\", storage: %q", conf.Database.Storage)
+	}
+	for name := range conf.Database.Partitions.RetentionMonths {
+		if !db.IsPartitioned(models.Timeframe(name)) {
+			log.Fatalf("Invalid timeframe in retention_months: %s", name)
+		}
+	}
+
+	database, err := db.NewDB(conf.DSN(), log)
+	if err != nil {
+		log.Fatalf("Failed to connect to DB: %v", err)
+	}
+
+	switch flag.Arg(0) {
+	case "maintain":
+		if !maintain(database, conf, time.Now(), *batchSize, log) {
+			os.Exit(1)
+		}
+	case "status":
+		if err := printStatus(database); err != nil {
+			log.Fatalf("Failed to list partitions: %v", err)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+// maintain creates, expires and drops the partitions of every partitioned table, it returns false
+// if the partitions of a table could not be maintained
+func maintain(database *db.DB, conf *config.Config, now time.Time, batchSize int, log *logrus.Logger) bool {
+	monthsAhead := db.MonthsAhead(conf.Database.Partitions.MonthsAhead)
+	archiveDir := conf.Retention.ArchiveDir
+	if archiveDir == "" {
+		archiveDir = archive.DefaultDir
+	}
+
+	ok := true
+	for _, tf := range db.PartitionedTimeframes {
+		spec, err := models.LookupTimeframe(tf)
+		if err != nil {
+			log.Errorf("Invalid timeframe: %s", tf)
+			ok = false
+			continue
+		}
+
+		created, err := database.EnsurePartitions(spec.Table, monthsAhead, now)
+		if err != nil {
+			ok = false
+			continue
+		}
+		log.Infof("Created %d partitions of %s: %v", len(created), spec.Table, created)
+
+		if keepMonths, expires := conf.Database.Partitions.RetentionMonths[string(tf)]; expires {
+			expired, err := database.ExpirePartitions(spec.Table, keepMonths, now)
+			if err != nil {
+				ok = false
+				continue
+			}
+			log.Infof("Detached %d expired partitions of %s: %v", len(expired), spec.Table, expired)
+		}
+
+		// partitions detached by earlier runs are dropped as well, even if the timeframe no longer expires
+		if !dropDetached(database, tf, spec.Table, archiveDir, now, batchSize, log) {
+			ok = false
+		}
+	}
+	return ok
+}
+
+// dropDetached archives the candles of the detached partitions of table, into one archive file
+// per series, and drops the partitions. It returns false if a partition could not be dropped,
+// the following ones are kept as well.
+func dropDetached(database *db.DB, tf models.Timeframe, table string, archiveDir string, now time.Time, batchSize int, log *logrus.Logger) bool {
+	detached, err := database.DetachedPartitions(table)
+	if err != nil {
+		return false
+	}
+
+	writers := make(map[db.Series]*archive.Writer)
+	defer func() {
+		for _, w := range writers {
+			if err := w.Close(); err != nil {
+				log.Errorf("Failed to close archive of %s, error: %v", table, err)
+			}
+		}
+	}()
+	write := func(s db.Series, data []models.CryptoOHLCV) error {
+		key := db.Series{TradingSymbol: s.TradingSymbol, VsCurrency: s.VsCurrency, Exchange: s.Exchange}
+		w, ok := writers[key]
+		if !ok {
+			path := archive.Path(archiveDir, tf, s.Exchange, s.TradingSymbol, s.VsCurrency, now)
+			var err error
+			if w, err = archive.Create(path); err != nil {
+				return err
+			}
+			log.Infof("Archiving %s %s:%s/%s data of detached partitions into %s", tf, s.Exchange, s.TradingSymbol, s.VsCurrency, path)
+			writers[key] = w
+		}
+		return w.Write(data)
+	}
+
+	for _, p := range detached {
+		archived, err := database.DropPartition(p, batchSize, write)
+		if err != nil {
+			log.Errorf("Failed to drop partition %s after archiving %d rows, error: %v", p.Name, archived, err)
+			return false
+		}
+		log.Infof("Dropped partition %s, archived rows: %d", p.Name, archived)
+	}
+	return true
+}
+
+// printStatus prints a table of the partitions of every partitioned table
+func printStatus(database *db.DB) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIMEFRAME\tPARTITION\tMONTH")
+	for _, tf := range db.PartitionedTimeframes {
+		spec, err := models.LookupTimeframe(tf)
+		if err != nil {
+			return err
+		}
+		partitions, err := database.Partitions(spec.Table)
+		if err != nil {
+			return err
+		}
+		for _, p := range partitions {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", tf, p.Name, p.Month.Format("2006-01"))
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"crypto_project/config"
+	"crypto_project/pkg/archive"
+	"crypto_project/pkg/db"
+	"crypto_project/pkg/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// expiredSeries is a series with candles older than the retention of its rule
+type expiredSeries struct {
+	timeframe models.Timeframe
+	series    db.Series
+	keepDays  int
+	cutoff    time.Time
+	rows      int64
+}
+
+func main() {
+	configFile := flag.String("config", "config.toml", "Config file")
+	dryRun := flag.Bool("dry-run", false, "Show how many candles each series would lose without archiving or deleting them")
+	batchSize := flag.Int("batch-size", 10000, "Candles archived and deleted per transaction")
+	flag.Parse()
+
+	log := logrus.New()
+	log.Out = os.Stdout
+	log.Level = logrus.InfoLevel
+
+	conf, err := config.ReadConfig(*configFile)
+	if err != nil {
+		log.Fatalf("Error reading config: %v", err)
+	}
+	if conf.Database.Driver == db.DriverSQLite {
+		log.Fatalf("Pruning needs PostgreSQL, driver: %s", conf.Database.Driver)
+	}
+	if len(conf.Retention.Rules) == 0 {
+		log.Infof("No retention rules configured")
+		return
+	}
+
+	var timeframes []models.Timeframe
+	rules := make(map[models.Timeframe][]config.RetentionRule)
+	for _, rule := range conf.Retention.Rules {
+		tf := models.Timeframe(rule.Timeframe)
+		if _, err := models.LookupTimeframe(tf); err != nil {
+			log.Fatalf("Invalid timeframe in retention rule: %s", rule.Timeframe)
+		}
+		if rule.KeepDays <= 0 {
+			log.Fatalf("Invalid keep_days of %s retention rule: %d", rule.Timeframe, rule.KeepDays)
+		}
+		if _, ok := rules[tf]; !ok {
+			timeframes = append(timeframes, tf)
+		}
+		rules[tf] = append(rules[tf], rule)
+	}
+
+	database, err := db.NewDB(conf.DSN(), log)
+	if err != nil {
+		log.Fatalf("Failed to connect to DB: %v", err)
+	}
+
+	now := time.Now()
+	var expired []expiredSeries
+	for _, tf := range timeframes {
+		found, err := findExpired(database, tf, rules[tf], now)
+		if err != nil {
+			log.Fatalf("Failed to find expired %s data: %v", tf, err)
+		}
+		expired = append(expired, found...)
+	}
+
+	if *dryRun {
+		printExpired(expired)
+		return
+	}
+
+	archiveDir := conf.Retention.ArchiveDir
+	if archiveDir == "" {
+		archiveDir = archive.DefaultDir
+	}
+	failed := 0
+	for _, e := range expired {
+		if err := prune(database, e, archiveDir, now, *batchSize, log); err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		log.Errorf("Failed to prune %d of %d series", failed, len(expired))
+		os.Exit(1)
+	}
+}
+
+// findExpired returns the series of timeframe with candles older than the retention of their rule
+func findExpired(database *db.DB, tf models.Timeframe, rules []config.RetentionRule, now time.Time) ([]expiredSeries, error) {
+	repo, err := database.Repository(tf)
+	if err != nil {
+		return nil, err
+	}
+	series, err := repo.Series()
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []expiredSeries
+	for _, s := range series {
+		rule, ok := ruleFor(rules, s.Exchange, s.TradingSymbol)
+		if !ok {
+			continue
+		}
+		cutoff := now.AddDate(0, 0, -rule.KeepDays)
+		if !s.First.Before(cutoff) {
+			continue
+		}
+
+		rows, err := repo.CountBefore(s.TradingSymbol, s.VsCurrency, s.Exchange, cutoff)
+		if err != nil {
+			return nil, err
+		}
+		expired = append(expired, expiredSeries{timeframe: tf, series: s, keepDays: rule.KeepDays, cutoff: cutoff, rows: rows})
+	}
+	return expired, nil
+}
+
+// ruleFor returns the rule of a series, a rule of its exchange-qualified symbol takes precedence
+// over a rule of its symbol, which takes precedence over a rule without a symbol
+func ruleFor(rules []config.RetentionRule, exchange string, tradingSymbol string) (config.RetentionRule, bool) {
+	var match config.RetentionRule
+	best := 0
+	for _, rule := range rules {
+		ruleExchange, ruleSymbol := config.ParseTradingSymbol(rule.Symbol)
+		rank := 0
+		switch {
+		case rule.Symbol == "":
+			rank = 1
+		case ruleSymbol == tradingSymbol && ruleExchange == "":
+			rank = 2
+		case ruleSymbol == tradingSymbol && ruleExchange == exchange:
+			rank = 3
+		}
+		if rank > best {
+			match, best = rule, rank
+		}
+	}
+	return match, best > 0
+}
+
+// prune archives and deletes the expired candles of a series in batches, every batch is
+// written to the archive before it is deleted
+func prune(database *db.DB, e expiredSeries, archiveDir string, now time.Time, batchSize int, log *logrus.Logger) error {
+	s := e.series
+	name := fmt.Sprintf("%s %s:%s/%s", e.timeframe, s.Exchange, s.TradingSymbol, s.VsCurrency)
+
+	repo, err := database.Repository(e.timeframe)
+	if err != nil {
+		return err
+	}
+
+	path := archive.Path(archiveDir, e.timeframe, s.Exchange, s.TradingSymbol, s.VsCurrency, now)
+	w, err := archive.Create(path)
+	if err != nil {
+		log.Errorf("Failed to create archive of %s, error: %v", name, err)
+		return err
+	}
+	defer func() {
+		if err := w.Close(); err != nil {
+			log.Errorf("Failed to close archive %s, error: %v", path, err)
+		}
+	}()
+
+	log.Infof("Pruning %s data before %s into %s", name, e.cutoff.Format(time.RFC3339), path)
+	total := 0
+	for {
+		deleted, err := repo.DeleteBefore(s.TradingSymbol, s.VsCurrency, s.Exchange, e.cutoff, batchSize, w.Write)
+		if err != nil {
+			log.Errorf("Failed to prune %s data after %d rows, error: %v", name, total, err)
+			return err
+		}
+		if deleted == 0 {
+			break
+		}
+		total += deleted
+		log.Debugf("Pruned %d rows of %s data", total, name)
+	}
+
+	log.Infof("Successfully pruned %s data, rows: %d", name, total)
+	return nil
+}
+
+// printExpired prints a table of the series and how many candles they would lose
+func printExpired(expired []expiredSeries) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIMEFRAME\tEXCHANGE\tSYMBOL\tVS CURRENCY\tKEEP DAYS\tCUTOFF\tROWS")
+	var total int64
+	for _, e := range expired {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%d\n", e.timeframe, e.series.Exchange, e.series.TradingSymbol,
+			e.series.VsCurrency, e.keepDays, e.cutoff.UTC().Format(time.RFC3339), e.rows)
+		total += e.rows
+	}
+	w.Flush()
+	fmt.Printf("%d rows of %d series would be archived and pruned\n", total, len(expired))
+}
@@ -1,25 +1,127 @@
 package config
 
-import "github.com/BurntSushi/toml"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
 
 type Config struct {
 	Database struct {
+		// Driver is "postgres" (default) or "sqlite" for a local database file at Path, for development
+		// without a PostgreSQL server. Migrations, partitions and prune need PostgreSQL.
+		Driver   string `toml:"driver"`
+		Path     string `toml:"path"`
 		Host     string `toml:"host"`
 		Port     int    `toml:"port"`
 		Username string `toml:"username"`
 		Password string `toml:"password"`
 		DBName   string `toml:"dbname"`
+		// BatchSize is how many rows are sent in one INSERT statement, default 1000
+		BatchSize int `toml:"batch_size"`
+		// BulkThreshold is the row count from which --fetch-all pages are saved with COPY, 0 disables it
+		BulkThreshold int `toml:"bulk_threshold"`
+		// Storage is "postgres" (default) for plain tables, "timescale" for TimescaleDB hypertables
+		// and continuous aggregates, or "partitioned" for tables partitioned by month, set up by migrate up
+		Storage    string `toml:"storage"`
+		Partitions struct {
+			// MonthsAhead is how many monthly partitions following the current month are created, default 3
+			MonthsAhead int `toml:"months_ahead"`
+			// RetentionMonths is how many months before the current one the partitions of a timeframe
+			// are kept attached, older ones are detached, then dropped once their candles are archived
+			// into retention.archive_dir. Partitions of timeframes not listed are never detached.
+			RetentionMonths map[string]int `toml:"retention_months"`
+		} `toml:"partitions"`
 	} `toml:"database"`
 	Cryptocompare struct {
 		APIKey string `toml:"api_key"`
+		// MaxRetries is how many times a transient API failure is retried, client default is used if not set
+		MaxRetries *int `toml:"max_retries"`
+		// RetryBaseDelaySeconds and RetryMaxDelaySeconds bound the backoff between retries,
+		// client defaults are used if not set
+		RetryBaseDelaySeconds int `toml:"retry_base_delay_seconds"`
+		RetryMaxDelaySeconds  int `toml:"retry_max_delay_seconds"`
+		// RateLimit throttles all API calls to the plan quota, disabled if no limit is set and sync is off.
+		// The calls left are always synced on start if per_day or per_month is set, fetching fails
+		// if they cannot be read, so every run respects the budget used by the previous ones.
+		RateLimit struct {
+			PerSecond   int  `toml:"per_second"`
+			PerMinute   int  `toml:"per_minute"`
+			PerHour     int  `toml:"per_hour"`
+			PerDay      int  `toml:"per_day"`
+			PerMonth    int  `toml:"per_month"`
+			SyncOnStart bool `toml:"sync_on_start"`
+		} `toml:"rate_limit"`
 	} `toml:"cryptocompare"`
+	Binance struct {
+		// BaseURL overrides the Binance API base URL if set
+		BaseURL string `toml:"base_url"`
+		// MaxRetries is how many times a transient API failure is retried, client default is used if not set
+		MaxRetries *int `toml:"max_retries"`
+		// RetryBaseDelaySeconds and RetryMaxDelaySeconds bound the backoff between retries,
+		// client defaults are used if not set
+		RetryBaseDelaySeconds int `toml:"retry_base_delay_seconds"`
+		RetryMaxDelaySeconds  int `toml:"retry_max_delay_seconds"`
+		// RequestsPerMinute throttles all API calls, pages are fetched with a short fixed pause if not set
+		RequestsPerMinute int `toml:"requests_per_minute"`
+	} `toml:"binance"`
 	Fetch struct {
+		// Provider is the source of OHLCV data, "cryptocompare" (default) or "binance"
+		Provider string `toml:"provider"`
+		// TradingSymbols are symbols like "BTC", or exchange-qualified like "Binance:BTC"
 		TradingSymbols []string `toml:"trading_symbols"`
-		VSCurrency     string   `toml:"vs_currency"`
-		LimitDaily     int      `toml:"limit_daily"`
-		LimitHourly    int      `toml:"limit_hourly"`
-		LimitMinute    int      `toml:"limit_minute"`
+		// VSCurrency is the quote currency if VSCurrencies is not set
+		VSCurrency string `toml:"vs_currency"`
+		// VSCurrencies are the quote currencies, every trading symbol is fetched against each of them
+		VSCurrencies []string `toml:"vs_currencies"`
+		// Pairs override the timeframes and limits of pairs, or add pairs to fetch
+		Pairs       []PairConfig `toml:"pairs"`
+		LimitDaily  int          `toml:"limit_daily"`
+		LimitHourly int          `toml:"limit_hourly"`
+		LimitMinute int          `toml:"limit_minute"`
+		// Aggregates are custom bar widths like "15m" or "4h", fetched with LimitAggregated
+		Aggregates      []string `toml:"aggregates"`
+		LimitAggregated int      `toml:"limit_aggregated"`
+		// IncrementalOverlap is how many bars before the latest stored one are fetched again with --incremental, default 3
+		IncrementalOverlap *int `toml:"incremental_overlap"`
+		// JobTimeoutSeconds is the deadline of a single download job, 0 means no deadline
+		JobTimeoutSeconds int `toml:"job_timeout_seconds"`
 	} `toml:"fetch"`
+	Lake struct {
+		// Dir is where saved candles are also merged into Parquet files for analytical queries,
+		// partitioned as timeframe=/symbol=/year=. The lake is not written if it is empty.
+		Dir string `toml:"dir"`
+	} `toml:"lake"`
+	Retention struct {
+		// ArchiveDir is where candles are archived before they are pruned or their partition is
+		// dropped, default "archive"
+		ArchiveDir string          `toml:"archive_dir"`
+		Rules      []RetentionRule `toml:"rules"`
+	} `toml:"retention"`
+}
+
+// RetentionRule holds the settings of a [[retention.rules]] table
+type RetentionRule struct {
+	// Timeframe is the timeframe the rule applies to, e.g. "minute"
+	Timeframe string `toml:"timeframe"`
+	// Symbol limits the rule to a trading symbol like "BTC", or exchange-qualified like "Binance:BTC".
+	// Rules of a symbol take precedence over rules of the timeframe without a symbol.
+	Symbol string `toml:"symbol"`
+	// KeepDays is how many days of candles are kept, older ones are archived and pruned
+	KeepDays int `toml:"keep_days"`
+}
+
+// PairConfig holds the settings of a [[fetch.pairs]] table
+type PairConfig struct {
+	// Symbol is a trading symbol like "BTC", or exchange-qualified like "Binance:BTC"
+	Symbol string `toml:"symbol"`
+	// VsCurrency is the quote currency, empty means every quote currency of the symbol
+	VsCurrency string `toml:"vs_currency"`
+	// Timeframes replace the default timeframes of the pair if set
+	Timeframes []string `toml:"timeframes"`
+	// Limits override the limit of each timeframe, e.g. { hourly = 48, "15m" = 96 }
+	Limits map[string]int `toml:"limits"`
 }
 
 func ReadConfig(filename string) (*Config, error) {
@@ -29,3 +131,32 @@ func ReadConfig(filename string) (*Config, error) {
 	}
 	return &conf, nil
 }
+
+// ParseTradingSymbol splits an exchange-qualified trading symbol like "Binance:BTC"
+// into exchange and symbol, exchange is empty if the symbol is not qualified
+func ParseTradingSymbol(s string) (exchange string, symbol string) {
+	if i := strings.Index(s, ":"); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return "", s
+}
+
+// QuoteCurrencies returns the quote currencies to fetch, VSCurrencies if set, otherwise VSCurrency
+func (c *Config) QuoteCurrencies() []string {
+	if len(c.Fetch.VSCurrencies) > 0 {
+		return c.Fetch.VSCurrencies
+	}
+	if c.Fetch.VSCurrency != "" {
+		return []string{c.Fetch.VSCurrency}
+	}
+	return nil
+}
+
+// DSN returns the data source name of the database in [database], the path of the file of SQLite
+func (c *Config) DSN() string {
+	if c.Database.Driver == "sqlite" {
+		return c.Database.Path
+	}
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=disable TimeZone=Asia/Taipei",
+		c.Database.Host, c.Database.Username, c.Database.Password, c.Database.DBName, c.Database.Port)
+}
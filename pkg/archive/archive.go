@@ -0,0 +1,85 @@
+package archive
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"crypto_project/pkg/models"
+)
+
+// DefaultDir is where candles are archived if no archive_dir is configured
+const DefaultDir = "archive"
+
+// Header is the header row of an archive file
+var Header = []string{
+	"exchange", "trading_symbol", "vs_currency", "provider", "timestamp",
+	"open", "high", "low", "close", "volume_from", "volume_to",
+}
+
+// Writer writes candles to a gzip compressed CSV file
+type Writer struct {
+	file *os.File
+	gz   *gzip.Writer
+	csv  *csv.Writer
+}
+
+// Path returns the path of the archive file of a series pruned at prunedAt, e.g.
+// dir/minute/CCCAGG_BTC_USD_20240101T000000Z.csv.gz
+func Path(dir string, timeframe models.Timeframe, exchange string, tradingSymbol string, vsCurrency string, prunedAt time.Time) string {
+	name := fmt.Sprintf("%s_%s_%s_%s.csv.gz", exchange, tradingSymbol, vsCurrency, prunedAt.UTC().Format("20060102T150405Z"))
+	return filepath.Join(dir, string(timeframe), name)
+}
+
+// Create creates the archive file at path and its directory, an existing file is not overwritten
+func Create(path string) (*Writer, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	gz := gzip.NewWriter(file)
+	w := &Writer{file: file, gz: gz, csv: csv.NewWriter(gz)}
+	if err := w.csv.Write(Header); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write appends data to the archive and syncs it to disk, so the candles can be deleted once it returns
+func (w *Writer) Write(data []models.CryptoOHLCV) error {
+	for _, d := range data {
+		err := w.csv.Write([]string{
+			d.Exchange, d.TradingSymbol, d.VsCurrency, d.Provider, d.Timestamp.UTC().Format(time.RFC3339),
+			d.Open.String(), d.High.String(), d.Low.String(), d.Close.String(), d.VolumeFrom.String(), d.VolumeTo.String(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	w.csv.Flush()
+	if err := w.csv.Error(); err != nil {
+		return err
+	}
+	if err := w.gz.Flush(); err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
+
+// Close completes the gzip stream and closes the file
+func (w *Writer) Close() error {
+	if err := w.gz.Close(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
@@ -0,0 +1,64 @@
+package archive
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"crypto_project/pkg/models"
+)
+
+func TestPath(t *testing.T) {
+	prunedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("Asia/Taipei", 8*60*60))
+	got := Path("archive", models.TimeframeMinute, "CCCAGG", "BTC", "USD", prunedAt)
+	assert.Equal(t, filepath.Join("archive", "minute", "CCCAGG_BTC_USD_20240101T190405Z.csv.gz"), got)
+}
+
+func TestWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "minute", "CCCAGG_BTC_USD.csv.gz")
+	w, err := Create(path)
+	require.NoError(t, err)
+
+	candle := func(ts int64, close string) models.CryptoOHLCV {
+		return models.CryptoOHLCV{
+			TradingSymbol: "BTC",
+			VsCurrency:    "USD",
+			Exchange:      "CCCAGG",
+			Provider:      "cryptocompare",
+			Timestamp:     time.Unix(ts, 0),
+			Open:          decimal.RequireFromString("1.5"),
+			High:          decimal.RequireFromString("2"),
+			Low:           decimal.RequireFromString("1"),
+			Close:         decimal.RequireFromString(close),
+			VolumeFrom:    decimal.RequireFromString("10"),
+			VolumeTo:      decimal.RequireFromString("15.25"),
+		}
+	}
+	require.NoError(t, w.Write([]models.CryptoOHLCV{candle(1700000000, "1.75")}))
+	require.NoError(t, w.Write([]models.CryptoOHLCV{candle(1700000060, "1.8")}))
+	require.NoError(t, w.Close())
+
+	_, err = Create(path)
+	assert.Error(t, err, "existing archive must not be overwritten")
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	require.NoError(t, err)
+	records, err := csv.NewReader(gz).ReadAll()
+	require.NoError(t, err)
+
+	assert.Equal(t, [][]string{
+		Header,
+		{"CCCAGG", "BTC", "USD", "cryptocompare", "2023-11-14T22:13:20Z", "1.5", "2", "1", "1.75", "10", "15.25"},
+		{"CCCAGG", "BTC", "USD", "cryptocompare", "2023-11-14T22:14:20Z", "1.5", "2", "1", "1.8", "10", "15.25"},
+	}, records)
+}
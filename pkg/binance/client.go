@@ -0,0 +1,433 @@
+package binance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultBaseURL = "https://api.binance.com"
+	klinesEndpoint = "api/v3/klines"
+	apiMaxLimit    = 1000
+
+	defaultMaxRetries     = 3
+	defaultRetryBaseDelay = time.Second
+	defaultRetryMaxDelay  = time.Minute
+	// pagePause is the pause between the pages of an iterator if no rate limiter is set
+	pagePause = 250 * time.Millisecond
+
+	// errCodeInvalidSymbol is returned by the API when the symbol does not exist
+	errCodeInvalidSymbol = -1121
+)
+
+var (
+	// ErrRateLimited is returned when the API rejects a request because the request weight limit is exceeded
+	ErrRateLimited = errors.New("binance: rate limit exceeded")
+	// ErrUnknownMarket is returned when the requested symbol does not exist
+	ErrUnknownMarket = errors.New("binance: unknown market")
+	// ErrServerError is returned when the API responds with a 5xx status code
+	ErrServerError = errors.New("binance: server error")
+)
+
+// Limiter paces API calls, e.g. a cryptocompare.RateLimiter
+type Limiter interface {
+	// Wait blocks until an API call is allowed, or ctx is done
+	Wait(ctx context.Context) error
+}
+
+// Client is a client of the public Binance klines REST API
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	logger     *logrus.Logger
+	now        func() time.Time
+	sleep      func(ctx context.Context, d time.Duration) error
+	limiter    Limiter
+
+	maxRetries     int
+	retryBaseDelay time.Duration
+	retryMaxDelay  time.Duration
+}
+
+// Option configures optional settings of a Client
+type Option func(*Client)
+
+// WithBaseURL overrides the Binance API base URL, e.g. to point the client at a test server
+func WithBaseURL(url string) Option {
+	return func(c *Client) {
+		c.baseURL = strings.TrimRight(url, "/")
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to send requests
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithClock sets the function used to get the current time
+func WithClock(now func() time.Time) Option {
+	return func(c *Client) {
+		c.now = now
+	}
+}
+
+// WithSleeper sets the function used to pause between pages and retries,
+// it should return early with ctx.Err() when ctx is done
+func WithSleeper(sleep func(ctx context.Context, d time.Duration) error) Option {
+	return func(c *Client) {
+		c.sleep = sleep
+	}
+}
+
+// WithRateLimiter makes the client wait for limiter before each API call, the
+// fixed pause between pages is skipped in favor of it
+func WithRateLimiter(limiter Limiter) Option {
+	return func(c *Client) {
+		c.limiter = limiter
+	}
+}
+
+// WithRetry sets how many times a transient failure is retried, and the bounds of
+// the jittered exponential backoff between attempts, maxRetries 0 disables retrying.
+// A delay which is not positive keeps the default one.
+func WithRetry(maxRetries int, baseDelay, maxDelay time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		if baseDelay > 0 {
+			c.retryBaseDelay = baseDelay
+		}
+		if maxDelay > 0 {
+			c.retryMaxDelay = maxDelay
+		}
+	}
+}
+
+// Kline is a candlestick returned by the klines endpoint
+type Kline struct {
+	OpenTime         time.Time
+	Open             decimal.Decimal
+	High             decimal.Decimal
+	Low              decimal.Decimal
+	Close            decimal.Decimal
+	Volume           decimal.Decimal
+	CloseTime        time.Time
+	QuoteAssetVolume decimal.Decimal
+}
+
+// UnmarshalJSON decodes a kline from the array format of the API:
+// [openTime, open, high, low, close, volume, closeTime, quoteAssetVolume, ...]
+func (k *Kline) UnmarshalJSON(b []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if len(raw) < 8 {
+		return fmt.Errorf("binance: kline has %d fields, want at least 8", len(raw))
+	}
+
+	var openTime, closeTime int64
+	if err := json.Unmarshal(raw[0], &openTime); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw[6], &closeTime); err != nil {
+		return err
+	}
+	k.OpenTime = time.UnixMilli(openTime).UTC()
+	k.CloseTime = time.UnixMilli(closeTime).UTC()
+
+	fields := []struct {
+		raw json.RawMessage
+		dst *decimal.Decimal
+	}{
+		{raw[1], &k.Open},
+		{raw[2], &k.High},
+		{raw[3], &k.Low},
+		{raw[4], &k.Close},
+		{raw[5], &k.Volume},
+		{raw[7], &k.QuoteAssetVolume},
+	}
+	for _, f := range fields {
+		if err := json.Unmarshal(f.raw, f.dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type errorResponse struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+// NewClient creates a new Client with given logger and options
+func NewClient(logger *logrus.Logger, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    defaultBaseURL,
+		httpClient: &http.Client{},
+		logger:     logger,
+		now:        time.Now,
+		sleep:      sleepContext,
+
+		maxRetries:     defaultMaxRetries,
+		retryBaseDelay: defaultRetryBaseDelay,
+		retryMaxDelay:  defaultRetryMaxDelay,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// FetchKlines fetches up to limit klines of symbol (e.g. "BTCUSDT") and interval (e.g. "1h")
+// closing before endTime, the most recent klines are fetched if endTime is zero.
+// Klines which are not closed yet are removed. The limit is lowered to the 1000 klines the API
+// returns at most. Transient failures are retried with jittered exponential backoff.
+func (c *Client) FetchKlines(ctx context.Context, symbol, interval string, limit int, endTime time.Time) ([]Kline, error) {
+	if limit > apiMaxLimit {
+		c.logger.Warnf("Limit %d of %s %s klines is above the API maximum, fetching %d", limit, symbol, interval, apiMaxLimit)
+		limit = apiMaxLimit
+	}
+
+	url := fmt.Sprintf("%s/%s?symbol=%s&interval=%s&limit=%d", c.baseURL, klinesEndpoint, symbol, interval, limit)
+	if !endTime.IsZero() {
+		url += fmt.Sprintf("&endTime=%d", endTime.UnixMilli())
+	}
+
+	for attempt := 0; ; attempt++ {
+		klines, retryAfter, err := c.doKlinesRequest(ctx, url)
+		if err == nil || !isRetryable(err) || attempt >= c.maxRetries || ctx.Err() != nil {
+			return klines, err
+		}
+
+		// the API bans clients which ignore Retry-After
+		delay := c.retryDelay(attempt)
+		if retryAfter > c.retryMaxDelay {
+			c.logger.Errorf("Not retrying, the API asks to retry after %s: %v", retryAfter, err)
+			return nil, err
+		} else if retryAfter > delay {
+			delay = retryAfter
+		}
+		c.logger.Warnf("Transient error fetching klines, retry %d/%d in %s: %v", attempt+1, c.maxRetries, delay, err)
+		if sleepErr := c.sleep(ctx, delay); sleepErr != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryDelay returns a random delay between 0 and min(retryMaxDelay, retryBaseDelay * 2^attempt)
+func (c *Client) retryDelay(attempt int) time.Duration {
+	delay := c.retryBaseDelay
+	for i := 0; i < attempt && delay < c.retryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > c.retryMaxDelay {
+		delay = c.retryMaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+// doKlinesRequest requests the klines of url, it returns the Retry-After delay of a rate limited request
+func (c *Client) doKlinesRequest(ctx context.Context, url string) ([]Kline, time.Duration, error) {
+	if c.limiter != nil {
+		if err := c.limiter.Wait(ctx); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	c.logger.Debugf("Fetching klines from URL: %s", url)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		c.logger.Errorf("Error creating HTTP request: %v", err)
+		return nil, 0, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		c.logger.Errorf("Error making HTTP GET request: %v", err)
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusTeapot {
+		c.logger.Errorf("Rate limited fetching klines: %s", resp.Status)
+		retryAfter, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return nil, time.Duration(retryAfter) * time.Second, fmt.Errorf("%w: %s", ErrRateLimited, resp.Status)
+	}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		c.logger.Errorf("Server error fetching klines: %s", resp.Status)
+		return nil, 0, fmt.Errorf("%w: %s", ErrServerError, resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var er errorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&er); err != nil {
+			return nil, 0, fmt.Errorf("binance: unexpected status %s", resp.Status)
+		}
+		c.logger.Errorf("Error fetching klines: %d %s", er.Code, er.Msg)
+		if er.Code == errCodeInvalidSymbol {
+			return nil, 0, fmt.Errorf("%w: %s", ErrUnknownMarket, er.Msg)
+		}
+		return nil, 0, fmt.Errorf("binance: error fetching klines: %d %s", er.Code, er.Msg)
+	}
+
+	var klines []Kline
+	if err := json.NewDecoder(resp.Body).Decode(&klines); err != nil {
+		c.logger.Errorf("Error decoding HTTP response: %v", err)
+		return nil, 0, err
+	}
+
+	sort.Slice(klines, func(i, j int) bool {
+		return klines[i].OpenTime.Before(klines[j].OpenTime)
+	})
+	return c.removeNotClosedKlines(klines), 0, nil
+}
+
+// isRetryable reports whether err is a transient failure worth retrying
+func isRetryable(err error) bool {
+	if errors.Is(err, ErrRateLimited) || errors.Is(err, ErrServerError) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// sleepContext pauses for d, returning early with ctx.Err() if ctx is done first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// removeNotClosedKlines removes the last kline if it is still open
+func (c *Client) removeNotClosedKlines(klines []Kline) []Kline {
+	if len(klines) > 0 && !klines[len(klines)-1].CloseTime.Before(c.now()) {
+		return klines[:len(klines)-1]
+	}
+	return klines
+}
+
+// FetchKlineRange fetches the klines of symbol and interval opening in [from, to), paging
+// backwards from to until from is covered. It returns them with the number of pages fetched,
+// the klines fetched so far are returned along with the error if a page fails.
+func (c *Client) FetchKlineRange(ctx context.Context, symbol, interval string, from, to time.Time) ([]Kline, int, error) {
+	if !to.After(from) {
+		return nil, 0, nil
+	}
+
+	it := c.AllKlinePages(ctx, symbol, interval)
+	it.endTime = to.Add(-time.Millisecond)
+
+	var pages [][]Kline
+	for it.Next() {
+		pages = append(pages, it.Page())
+		if !it.Page()[0].OpenTime.After(from) {
+			break
+		}
+	}
+
+	// pages are fetched from the most recent one back
+	var klines []Kline
+	for i := len(pages) - 1; i >= 0; i-- {
+		for _, k := range pages[i] {
+			if !k.OpenTime.Before(from) && k.OpenTime.Before(to) {
+				klines = append(klines, k)
+			}
+		}
+	}
+	return klines, it.Pages(), it.Err()
+}
+
+// KlinePageIterator walks the whole kline history of a symbol one page at a time,
+// from the most recent page back to the oldest one
+type KlinePageIterator struct {
+	c        *Client
+	ctx      context.Context
+	symbol   string
+	interval string
+	endTime  time.Time
+
+	page  []Kline
+	pages int
+	done  bool
+	err   error
+}
+
+// AllKlinePages returns an iterator over all available klines of symbol and interval
+func (c *Client) AllKlinePages(ctx context.Context, symbol, interval string) *KlinePageIterator {
+	return &KlinePageIterator{
+		c:        c,
+		ctx:      ctx,
+		symbol:   symbol,
+		interval: interval,
+	}
+}
+
+// Next fetches the next page, it returns false when there is no more data or an error occurred.
+// Pages are paced by the rate limiter of the client, or by a fixed pause if it has none.
+func (it *KlinePageIterator) Next() bool {
+	if it.done {
+		return false
+	}
+
+	if it.pages > 0 && it.c.limiter == nil {
+		if err := it.c.sleep(it.ctx, pagePause); err != nil {
+			it.page = nil
+			it.done = true
+			it.err = err
+			return false
+		}
+	}
+
+	klines, err := it.c.FetchKlines(it.ctx, it.symbol, it.interval, apiMaxLimit, it.endTime)
+	// stop if the API returned no klines older than the previous page
+	if err != nil || len(klines) == 0 || (!it.endTime.IsZero() && klines[0].OpenTime.After(it.endTime)) {
+		it.page = nil
+		it.done = true
+		it.err = err
+		return false
+	}
+
+	it.page = klines
+	it.pages++
+	it.endTime = klines[0].OpenTime.Add(-time.Millisecond)
+	return true
+}
+
+// Page returns the page fetched by the last call to Next
+func (it *KlinePageIterator) Page() []Kline {
+	return it.page
+}
+
+// Pages returns how many pages have been fetched so far
+func (it *KlinePageIterator) Pages() int {
+	return it.pages
+}
+
+// Err returns the error which stopped the iteration, nil if all data has been fetched
+func (it *KlinePageIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,270 @@
+package binance
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestClient creates a Client talking to a fake Binance server, the clock is fixed at now
+// and pauses are recorded in sleeps instead of slowing the test
+func newTestClient(t *testing.T, handler http.HandlerFunc, now time.Time, sleeps *[]time.Duration) *Client {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	logger := logrus.New()
+	logger.Out = io.Discard
+
+	return NewClient(logger,
+		WithBaseURL(server.URL),
+		WithHTTPClient(server.Client()),
+		WithClock(func() time.Time { return now }),
+		WithSleeper(func(ctx context.Context, d time.Duration) error {
+			*sleeps = append(*sleeps, d)
+			return ctx.Err()
+		}),
+	)
+}
+
+// writeKlines writes hourly klines opening at the given unix milliseconds
+func writeKlines(w http.ResponseWriter, openTimes ...int64) {
+	fmt.Fprint(w, "[")
+	for i, ts := range openTimes {
+		if i > 0 {
+			fmt.Fprint(w, ",")
+		}
+		fmt.Fprintf(w, `[%d,"1.5","2.5","0.5","2.0","10.0",%d,"20.0",5,"1","2","0"]`, ts, ts+3600000-1)
+	}
+	fmt.Fprint(w, "]")
+}
+
+func TestFetchKlines(t *testing.T) {
+	var sleeps []time.Duration
+	const hour = int64(3600000)
+	now := time.UnixMilli(3*hour + 60000)
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v3/klines", r.URL.Path)
+		assert.Equal(t, "BTCUSDT", r.URL.Query().Get("symbol"))
+		assert.Equal(t, "1h", r.URL.Query().Get("interval"))
+		assert.Equal(t, "3", r.URL.Query().Get("limit"))
+		assert.Empty(t, r.URL.Query().Get("endTime"))
+		// the kline of hour 3 is still open
+		writeKlines(w, 1*hour, 2*hour, 3*hour)
+	}, now, &sleeps)
+
+	klines, err := client.FetchKlines(context.Background(), "BTCUSDT", "1h", 3, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, klines, 2)
+
+	k := klines[0]
+	assert.Equal(t, time.UnixMilli(hour).UTC(), k.OpenTime)
+	assert.True(t, k.Open.Equal(decimal.RequireFromString("1.5")))
+	assert.True(t, k.High.Equal(decimal.RequireFromString("2.5")))
+	assert.True(t, k.Low.Equal(decimal.RequireFromString("0.5")))
+	assert.True(t, k.Close.Equal(decimal.RequireFromString("2")))
+	assert.True(t, k.Volume.Equal(decimal.RequireFromString("10")))
+	assert.True(t, k.QuoteAssetVolume.Equal(decimal.RequireFromString("20")))
+}
+
+func TestFetchKlinesErrors(t *testing.T) {
+	var sleeps []time.Duration
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("symbol") {
+		case "FOOBAR":
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"code":-1121,"msg":"Invalid symbol."}`)
+		default:
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}, time.Now(), &sleeps)
+
+	_, err := client.FetchKlines(context.Background(), "FOOBAR", "1h", 1, time.Time{})
+	assert.ErrorIs(t, err, ErrUnknownMarket)
+
+	_, err = client.FetchKlines(context.Background(), "BTCUSDT", "1h", 1, time.Time{})
+	assert.ErrorIs(t, err, ErrRateLimited)
+}
+
+func TestKlinePageIterator(t *testing.T) {
+	var sleeps []time.Duration
+	const hour = int64(3600000)
+	var endTimes []string
+
+	// serves klines of hour 0 to 2999, pages of up to 1000 klines ending at endTime
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		endTimes = append(endTimes, r.URL.Query().Get("endTime"))
+
+		last := int64(2999)
+		if endTime := r.URL.Query().Get("endTime"); endTime != "" {
+			ms, err := strconv.ParseInt(endTime, 10, 64)
+			require.NoError(t, err)
+			last = ms / hour
+			if ms < 0 {
+				last = -1
+			}
+		}
+		var openTimes []int64
+		for h := last - 999; h <= last; h++ {
+			if h >= 0 {
+				openTimes = append(openTimes, h*hour)
+			}
+		}
+		writeKlines(w, openTimes...)
+	}, time.UnixMilli(3000*hour), &sleeps)
+
+	it := client.AllKlinePages(context.Background(), "BTCUSDT", "1h")
+	total := 0
+	for it.Next() {
+		total += len(it.Page())
+	}
+
+	require.NoError(t, it.Err())
+	assert.Equal(t, 3, it.Pages())
+	assert.Equal(t, 3000, total)
+	assert.Equal(t, []string{"", strconv.FormatInt(2000*hour-1, 10), strconv.FormatInt(1000*hour-1, 10), "-1"}, endTimes)
+	assert.Equal(t, []time.Duration{pagePause, pagePause, pagePause}, sleeps, "requests after the first page are paced")
+}
+
+func TestFetchKlineRange(t *testing.T) {
+	var sleeps []time.Duration
+	const hour = int64(3600000)
+	var endTimes []string
+
+	// serves klines of hour 0 to 2999, pages of up to 1000 klines ending at endTime
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		endTimes = append(endTimes, r.URL.Query().Get("endTime"))
+
+		ms, err := strconv.ParseInt(r.URL.Query().Get("endTime"), 10, 64)
+		require.NoError(t, err)
+		var openTimes []int64
+		for h := ms/hour - 999; h <= ms/hour; h++ {
+			if h >= 0 {
+				openTimes = append(openTimes, h*hour)
+			}
+		}
+		writeKlines(w, openTimes...)
+	}, time.UnixMilli(3000*hour), &sleeps)
+
+	klines, pages, err := client.FetchKlineRange(context.Background(), "BTCUSDT", "1h", time.UnixMilli(500*hour), time.UnixMilli(1600*hour))
+	require.NoError(t, err)
+	assert.Equal(t, 2, pages)
+
+	require.Len(t, klines, 1100)
+	assert.Equal(t, 500*hour, klines[0].OpenTime.UnixMilli())
+	assert.Equal(t, 1599*hour, klines[len(klines)-1].OpenTime.UnixMilli())
+	assert.Equal(t, []string{strconv.FormatInt(1600*hour-1, 10), strconv.FormatInt(600*hour-1, 10)}, endTimes)
+}
+
+func TestFetchKlinesLimit(t *testing.T) {
+	var sleeps []time.Duration
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "1000", r.URL.Query().Get("limit"))
+		writeKlines(w)
+	}, time.Now(), &sleeps)
+
+	_, err := client.FetchKlines(context.Background(), "BTCUSDT", "1h", 5000, time.Time{})
+	require.NoError(t, err)
+}
+
+func TestFetchKlinesRetry(t *testing.T) {
+	var sleeps []time.Duration
+	requests := 0
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch requests {
+		case 1:
+			w.Header().Set("Retry-After", "5")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			writeKlines(w, 0)
+		}
+	}, time.UnixMilli(2*3600000), &sleeps)
+	WithRetry(3, time.Second, 10*time.Second)(client)
+
+	klines, err := client.FetchKlines(context.Background(), "BTCUSDT", "1h", 1, time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, klines, 1)
+	assert.Equal(t, 3, requests)
+	require.Len(t, sleeps, 2)
+	assert.Equal(t, 5*time.Second, sleeps[0], "Retry-After is honored")
+	assert.LessOrEqual(t, sleeps[1], 2*time.Second)
+}
+
+func TestFetchKlinesRetryAfterTooLong(t *testing.T) {
+	var sleeps []time.Duration
+	requests := 0
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTeapot)
+	}, time.Now(), &sleeps)
+
+	_, err := client.FetchKlines(context.Background(), "BTCUSDT", "1h", 1, time.Time{})
+	assert.ErrorIs(t, err, ErrRateLimited)
+	assert.Equal(t, 1, requests)
+	assert.Empty(t, sleeps)
+}
+
+func TestFetchKlinesRetriesExhausted(t *testing.T) {
+	var sleeps []time.Duration
+	requests := 0
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}, time.Now(), &sleeps)
+	WithRetry(2, time.Second, time.Second)(client)
+
+	_, err := client.FetchKlines(context.Background(), "BTCUSDT", "1h", 1, time.Time{})
+	assert.ErrorIs(t, err, ErrServerError)
+	assert.Equal(t, 3, requests)
+	assert.Len(t, sleeps, 2)
+}
+
+// countingLimiter counts the calls it allows
+type countingLimiter struct{ waits int }
+
+func (l *countingLimiter) Wait(ctx context.Context) error {
+	l.waits++
+	return ctx.Err()
+}
+
+func TestKlinePageIteratorRateLimiter(t *testing.T) {
+	const hour = int64(3600000)
+	var sleeps []time.Duration
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("endTime") == "" {
+			writeKlines(w, 0, hour)
+		} else {
+			writeKlines(w)
+		}
+	}, time.UnixMilli(3*hour), &sleeps)
+	limiter := &countingLimiter{}
+	WithRateLimiter(limiter)(client)
+
+	it := client.AllKlinePages(context.Background(), "BTCUSDT", "1h")
+	for it.Next() {
+	}
+	require.NoError(t, it.Err())
+	assert.Equal(t, 1, it.Pages())
+	assert.Equal(t, 2, limiter.waits)
+	assert.Empty(t, sleeps, "the rate limiter replaces the pause between pages")
+}
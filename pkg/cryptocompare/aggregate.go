@@ -0,0 +1,41 @@
+package cryptocompare
+
+import (
+	"context"
+
+	"crypto_project/pkg/models"
+)
+
+// FetchAggregatedOHLCVData fetches bars of the given width up to given limit
+func (c *Client) FetchAggregatedOHLCVData(tradingSymbol, vsCurrency string, width models.BarWidth, limit int) ([]OHLCVData, error) {
+	return c.FetchAggregatedOHLCVDataContext(context.Background(), tradingSymbol, vsCurrency, width, limit)
+}
+
+// FetchAggregatedOHLCVDataContext is like FetchAggregatedOHLCVData but aborts when ctx is done
+func (c *Client) FetchAggregatedOHLCVDataContext(ctx context.Context, tradingSymbol, vsCurrency string, width models.BarWidth, limit int) ([]OHLCVData, error) {
+	c.logger.Tracef("Fetching %s OHLCV data", width)
+
+	endpoint, err := histoEndpoint(width.Timeframe)
+	if err != nil {
+		return nil, err
+	}
+
+	url := c.histoURL(endpoint, histoQuery{
+		tradingSymbol: tradingSymbol,
+		vsCurrency:    vsCurrency,
+		limit:         int64(limit),
+		aggregate:     width.Aggregate,
+	})
+
+	resp, err := c.getOHLCVResponseFromApi(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	data := resp.Data.Data
+	if width.Timeframe == models.TimeframeMinute {
+		// remove last row if it's not ready yet
+		data = removeNotReadyData(data)
+	}
+	return data, nil
+}
@@ -0,0 +1,31 @@
+package cryptocompare
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"crypto_project/pkg/models"
+)
+
+func TestFetchAggregatedOHLCVData(t *testing.T) {
+	var sleeps []time.Duration
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/histohour", r.URL.Path)
+		assert.Equal(t, "4", r.URL.Query().Get("aggregate"))
+		assert.Equal(t, "10", r.URL.Query().Get("limit"))
+		writeTestResponse(t, w, 0, []OHLCVData{
+			{Time: 0, VolumeFrom: decimal.NewFromInt(1)},
+			{Time: 4 * 3600, VolumeFrom: decimal.NewFromInt(1)},
+		})
+	}, &sleeps)
+
+	data, err := client.FetchAggregatedOHLCVData("BTC", "USD", models.BarWidth{Timeframe: models.TimeframeHourly, Aggregate: 4}, 10)
+	require.NoError(t, err)
+	assert.Len(t, data, 2)
+}
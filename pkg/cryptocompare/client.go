@@ -1,28 +1,89 @@
 package cryptocompare
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"math/rand"
 	"net/http"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/shopspring/decimal"
 	"github.com/sirupsen/logrus"
+
+	"crypto_project/pkg/models"
 )
 
 const (
-	baseURL             = "https://min-api.cryptocompare.com/data/v2"
+	defaultBaseURL      = "https://min-api.cryptocompare.com/data/v2"
 	histohourEndpoint   = "histohour"
 	histodayEndpoint    = "histoday"
 	histominuteEndpoint = "histominute"
 	apiMaxLimit         = 2000
+
+	defaultMaxRetries     = 3
+	defaultRetryBaseDelay = time.Second
+	defaultRetryMaxDelay  = time.Minute
 )
 
 type Client struct {
 	apiKey     string
+	baseURL    string
 	httpClient *http.Client
 	logger     *logrus.Logger
+	now        func() time.Time
+	sleep      func(ctx context.Context, d time.Duration) error
+
+	maxRetries     int
+	retryBaseDelay time.Duration
+	retryMaxDelay  time.Duration
+
+	limiter      *RateLimiter
+	rateLimitURL string
+
+	// exchange is sent as the e parameter, empty means the CCCAGG aggregate index
+	exchange string
+}
+
+// Option configures optional settings of a Client
+type Option func(*Client)
+
+// WithBaseURL overrides the CryptoCompare API base URL, e.g. to point the client at a test server
+func WithBaseURL(url string) Option {
+	return func(c *Client) {
+		c.baseURL = strings.TrimRight(url, "/")
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to send requests
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithTransport sets the RoundTripper of the HTTP client used to send requests
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *Client) {
+		c.httpClient = &http.Client{Transport: transport}
+	}
+}
+
+// WithClock sets the function used to get the current time
+func WithClock(now func() time.Time) Option {
+	return func(c *Client) {
+		c.now = now
+	}
+}
+
+// WithSleeper sets the function used to pause between paginated requests,
+// it should return early with ctx.Err() when ctx is done
+func WithSleeper(sleep func(ctx context.Context, d time.Duration) error) Option {
+	return func(c *Client) {
+		c.sleep = sleep
+	}
 }
 
 type OHLCVData struct {
@@ -48,20 +109,62 @@ type CryptoResponse struct {
 	} `json:"Data"`
 }
 
-// NewClient creates a new Client with given API key and logger
-func NewClient(apiKey string, logger *logrus.Logger) *Client {
-	return &Client{
+// WithRetry sets how many times a transient failure is retried, and the bounds of
+// the jittered exponential backoff between attempts, maxRetries 0 disables retrying.
+// A delay which is not positive keeps the default one.
+func WithRetry(maxRetries int, baseDelay, maxDelay time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		if baseDelay > 0 {
+			c.retryBaseDelay = baseDelay
+		}
+		if maxDelay > 0 {
+			c.retryMaxDelay = maxDelay
+		}
+	}
+}
+
+// NewClient creates a new Client with given API key, logger and options
+func NewClient(apiKey string, logger *logrus.Logger, opts ...Option) *Client {
+	c := &Client{
 		apiKey:     apiKey,
+		baseURL:    defaultBaseURL,
 		httpClient: &http.Client{},
 		logger:     logger,
+		now:        time.Now,
+		sleep:      sleepContext,
+
+		maxRetries:     defaultMaxRetries,
+		retryBaseDelay: defaultRetryBaseDelay,
+		retryMaxDelay:  defaultRetryMaxDelay,
+
+		rateLimitURL: defaultRateLimitURL,
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
+	return c
+}
+
+// ForExchange returns a copy of the client fetching the OHLCV data of the given
+// exchange (e.g. "Binance") instead of the CCCAGG aggregate index, the copy shares
+// the HTTP client and rate limiter with c
+func (c *Client) ForExchange(exchange string) *Client {
+	cc := *c
+	cc.exchange = exchange
+	return &cc
 }
 
 // FetchMinuteOHLCVData fetches minute-level OHLCV data up to given limit
 func (c *Client) FetchMinuteOHLCVData(tradingSymbol, vsCurrency string, limit int) ([]OHLCVData, error) {
+	return c.FetchMinuteOHLCVDataContext(context.Background(), tradingSymbol, vsCurrency, limit)
+}
+
+// FetchMinuteOHLCVDataContext is like FetchMinuteOHLCVData but aborts when ctx is done
+func (c *Client) FetchMinuteOHLCVDataContext(ctx context.Context, tradingSymbol, vsCurrency string, limit int) ([]OHLCVData, error) {
 	c.logger.Trace("Fetching minute-level OHLCV data")
 
-	data, err := c.fetchOHLCVData(tradingSymbol, vsCurrency, limit, histominuteEndpoint)
+	data, err := c.fetchOHLCVData(ctx, tradingSymbol, vsCurrency, limit, histominuteEndpoint)
 	if data != nil {
 		// remove last row if it's not ready yet
 		data = removeNotReadyData(data)
@@ -72,85 +175,72 @@ func (c *Client) FetchMinuteOHLCVData(tradingSymbol, vsCurrency string, limit in
 
 // FetchHourlyOHLCVData fetches hourly-level OHLCV data up to given limit
 func (c *Client) FetchHourlyOHLCVData(tradingSymbol, vsCurrency string, limit int) ([]OHLCVData, error) {
+	return c.FetchHourlyOHLCVDataContext(context.Background(), tradingSymbol, vsCurrency, limit)
+}
+
+// FetchHourlyOHLCVDataContext is like FetchHourlyOHLCVData but aborts when ctx is done
+func (c *Client) FetchHourlyOHLCVDataContext(ctx context.Context, tradingSymbol, vsCurrency string, limit int) ([]OHLCVData, error) {
 	c.logger.Trace("Fetching hourly-level OHLCV data")
-	return c.fetchOHLCVData(tradingSymbol, vsCurrency, limit, histohourEndpoint)
+	return c.fetchOHLCVData(ctx, tradingSymbol, vsCurrency, limit, histohourEndpoint)
 }
 
 // FetchDailyOHLCVData fetches daily-level OHLCV data up to given limit
 func (c *Client) FetchDailyOHLCVData(tradingSymbol, vsCurrency string, limit int) ([]OHLCVData, error) {
+	return c.FetchDailyOHLCVDataContext(context.Background(), tradingSymbol, vsCurrency, limit)
+}
+
+// FetchDailyOHLCVDataContext is like FetchDailyOHLCVData but aborts when ctx is done
+func (c *Client) FetchDailyOHLCVDataContext(ctx context.Context, tradingSymbol, vsCurrency string, limit int) ([]OHLCVData, error) {
 	c.logger.Trace("Fetching daily-level OHLCV data")
-	return c.fetchOHLCVData(tradingSymbol, vsCurrency, limit, histodayEndpoint)
+	return c.fetchOHLCVData(ctx, tradingSymbol, vsCurrency, limit, histodayEndpoint)
 }
 
 // FetchAllMinuteOHLCVData fetches all minute-level OHLCV data
 func (c *Client) FetchAllMinuteOHLCVData(tradingSymbol, vsCurrency string) ([]OHLCVData, error) {
-	c.logger.Trace("Fetching all minute-level OHLCV data")
-	data, err := c.fetchAllOHLCVData(tradingSymbol, vsCurrency, histominuteEndpoint)
-	if data == nil && err != nil {
-		return nil, err
-	}
-
-	// remove last row if it's not ready yet
-	data = removeNotReadyData(data)
+	return c.FetchAllMinuteOHLCVDataContext(context.Background(), tradingSymbol, vsCurrency)
+}
 
-	return data, err
+// FetchAllMinuteOHLCVDataContext is like FetchAllMinuteOHLCVData but stops when ctx is done,
+// returning the data fetched so far along with the context error
+func (c *Client) FetchAllMinuteOHLCVDataContext(ctx context.Context, tradingSymbol, vsCurrency string) ([]OHLCVData, error) {
+	c.logger.Trace("Fetching all minute-level OHLCV data")
+	return c.fetchAllOHLCVData(ctx, tradingSymbol, vsCurrency, models.TimeframeMinute)
 }
 
 // FetchAllHourlyOHLCVData fetches all hourly-level OHLCV data
 func (c *Client) FetchAllHourlyOHLCVData(tradingSymbol, vsCurrency string) ([]OHLCVData, error) {
+	return c.FetchAllHourlyOHLCVDataContext(context.Background(), tradingSymbol, vsCurrency)
+}
+
+// FetchAllHourlyOHLCVDataContext is like FetchAllHourlyOHLCVData but stops when ctx is done,
+// returning the data fetched so far along with the context error
+func (c *Client) FetchAllHourlyOHLCVDataContext(ctx context.Context, tradingSymbol, vsCurrency string) ([]OHLCVData, error) {
 	c.logger.Trace("Initiating FetchAllHourlyOHLCVData request.")
-	return c.fetchAllOHLCVData(tradingSymbol, vsCurrency, histohourEndpoint)
+	return c.fetchAllOHLCVData(ctx, tradingSymbol, vsCurrency, models.TimeframeHourly)
 }
 
 // FetchAllDailyOHLCVData fetches all available daily-level OHLCV data from the CryptoCompare API.
 func (c *Client) FetchAllDailyOHLCVData(tradingSymbol, vsCurrency string) ([]OHLCVData, error) {
+	return c.FetchAllDailyOHLCVDataContext(context.Background(), tradingSymbol, vsCurrency)
+}
+
+// FetchAllDailyOHLCVDataContext is like FetchAllDailyOHLCVData but stops when ctx is done,
+// returning the data fetched so far along with the context error
+func (c *Client) FetchAllDailyOHLCVDataContext(ctx context.Context, tradingSymbol, vsCurrency string) ([]OHLCVData, error) {
 	c.logger.Trace("Initiating FetchAllDailyOHLCVData request.")
-	return c.fetchAllOHLCVData(tradingSymbol, vsCurrency, histodayEndpoint)
+	return c.fetchAllOHLCVData(ctx, tradingSymbol, vsCurrency, models.TimeframeDaily)
 }
 
 // fetchAllOHLCVData fetches all available OHLCV data of a specific frequency from the CryptoCompare API.
-func (c *Client) fetchAllOHLCVData(tradingSymbol, vsCurrency string, endpoint string) ([]OHLCVData, error) {
+func (c *Client) fetchAllOHLCVData(ctx context.Context, tradingSymbol, vsCurrency string, timeframe models.Timeframe) ([]OHLCVData, error) {
 	c.logger.Info("Starting fetchAllOHLCVData request.")
 	var allData []OHLCVData
-	var err error = nil
-
-	// Add 5 seconds to avoid losing data due to time difference
-	var toTs int64 = time.Now().Unix() + 5
-
-	for {
-		c.logger.Debugf("Fetching more data for %s/%s in fetchAllOHLCVData, toTs: %s",
-			tradingSymbol, vsCurrency, time.Unix(toTs, 0).In(time.UTC).Format(time.RFC3339))
-
-		url := fmt.Sprintf("%s/%s?fsym=%s&tsym=%s&limit=%d&toTs=%d&api_key=%s",
-			baseURL, endpoint, tradingSymbol, vsCurrency, apiMaxLimit, toTs, c.apiKey)
-		c.logger.Trace("URL: ", url)
-
-		var resp *CryptoResponse
-		resp, err = c.getOHLCVResponseFromApi(url)
-		if err != nil {
-			c.logger.Errorf("Error in getOHLCVResponseFromApi for %s/%s: %v", tradingSymbol, vsCurrency, err)
-			break
-		}
-
-		data := resp.Data.Data
-		if len(data) == 0 {
-			c.logger.Tracef("No more data to fetch OHLCV history for %s/%s in fetchAllOHLCVData", tradingSymbol, vsCurrency)
-			break
-		}
-
-		if isVolumeFromZeroInDataSet(data) {
-			if len(data) != 0 {
-				c.logger.Warnf("Encountered fake dataset for %s/%s in fetchAllOHLCVData, stop the iteration", tradingSymbol, vsCurrency)
-			}
-			break
-		}
-
-		allData = append(allData, data...)
-		toTs = resp.Data.TimeFrom - 1
 
-		c.logger.Debugf("Pause before next fetchAllOHLCVData iteration for %s/%s...", tradingSymbol, vsCurrency)
-		time.Sleep(10 * time.Second)
+	it := c.AllOHLCVDataPages(ctx, tradingSymbol, vsCurrency, timeframe)
+	for it.Next() {
+		allData = append(allData, it.Page()...)
 	}
+	err := it.Err()
 
 	if len(allData) == 0 {
 		return nil, err
@@ -167,27 +257,109 @@ func (c *Client) fetchAllOHLCVData(tradingSymbol, vsCurrency string, endpoint st
 	return allData, err
 }
 
-func (c *Client) fetchOHLCVData(tradingSymbol, vsCurrency string, limit int, endpoint string) ([]OHLCVData, error) {
-	url := fmt.Sprintf("%s/%s?fsym=%s&tsym=%s&limit=%d&api_key=%s",
-		baseURL, endpoint, tradingSymbol, vsCurrency, limit, c.apiKey)
+func (c *Client) fetchOHLCVData(ctx context.Context, tradingSymbol, vsCurrency string, limit int, endpoint string) ([]OHLCVData, error) {
+	url := c.histoURL(endpoint, histoQuery{
+		tradingSymbol: tradingSymbol,
+		vsCurrency:    vsCurrency,
+		limit:         int64(limit),
+	})
 
-	if resp, err := c.getOHLCVResponseFromApi(url); err != nil {
+	if resp, err := c.getOHLCVResponseFromApi(ctx, url); err != nil {
 		return nil, err
 	} else {
 		return resp.Data.Data, nil
 	}
 }
 
-func (c *Client) getOHLCVResponseFromApi(url string) (*CryptoResponse, error) {
+// histoQuery holds the query parameters of a histo endpoint request
+type histoQuery struct {
+	tradingSymbol string
+	vsCurrency    string
+	limit         int64
+	// toTs is omitted if 0, the API then returns the most recent bars
+	toTs int64
+	// aggregate is omitted if 0 or 1
+	aggregate int
+}
+
+// histoURL builds the URL of a histo endpoint request
+func (c *Client) histoURL(endpoint string, q histoQuery) string {
+	url := fmt.Sprintf("%s/%s?fsym=%s&tsym=%s&limit=%d",
+		c.baseURL, endpoint, q.tradingSymbol, q.vsCurrency, q.limit)
+	if q.toTs != 0 {
+		url += fmt.Sprintf("&toTs=%d", q.toTs)
+	}
+	if q.aggregate > 1 {
+		url += fmt.Sprintf("&aggregate=%d", q.aggregate)
+	}
+	if c.exchange != "" {
+		url += "&e=" + c.exchange
+	}
+	return url + "&api_key=" + c.apiKey
+}
+
+// getOHLCVResponseFromApi requests url, retrying transient failures with jittered exponential backoff
+func (c *Client) getOHLCVResponseFromApi(ctx context.Context, url string) (*CryptoResponse, error) {
+	for attempt := 0; ; attempt++ {
+		cr, err := c.doOHLCVRequest(ctx, url)
+		if err == nil || !isRetryable(err) || attempt >= c.maxRetries || ctx.Err() != nil {
+			return cr, err
+		}
+
+		delay := c.retryDelay(attempt)
+		c.logger.Warnf("Transient error fetching data, retry %d/%d in %s: %v", attempt+1, c.maxRetries, delay, err)
+		if sleepErr := c.sleep(ctx, delay); sleepErr != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryDelay returns a random delay between 0 and min(retryMaxDelay, retryBaseDelay * 2^attempt)
+func (c *Client) retryDelay(attempt int) time.Duration {
+	delay := c.retryBaseDelay
+	for i := 0; i < attempt && delay < c.retryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > c.retryMaxDelay {
+		delay = c.retryMaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+func (c *Client) doOHLCVRequest(ctx context.Context, url string) (*CryptoResponse, error) {
+	if c.limiter != nil {
+		if err := c.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+
 	c.logger.Debugf("Fetching data from URL: %s", url)
 
-	resp, err := c.httpClient.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		c.logger.Errorf("Error creating HTTP request: %v", err)
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		c.logger.Errorf("Error making HTTP GET request: %v", err)
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode >= http.StatusInternalServerError {
+		c.logger.Errorf("Server error fetching data: %s", resp.Status)
+		return nil, fmt.Errorf("%w: %s", ErrServerError, resp.Status)
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		c.logger.Errorf("Rate limited fetching data: %s", resp.Status)
+		return nil, fmt.Errorf("%w: %s", ErrRateLimited, resp.Status)
+	}
+
 	var cr CryptoResponse
 	if err := json.NewDecoder(resp.Body).Decode(&cr); err != nil {
 		c.logger.Errorf("Error decoding HTTP response: %v", err)
@@ -196,7 +368,7 @@ func (c *Client) getOHLCVResponseFromApi(url string) (*CryptoResponse, error) {
 
 	if cr.Response == "Error" {
 		c.logger.Errorf("Error fetching data: %s", cr.Message)
-		return nil, fmt.Errorf("error fetching data: %s", cr.Message)
+		return nil, parseAPIError(cr.Message)
 	}
 
 	c.logger.Debugf("Successfully fetched data from URL: %s", url)
@@ -204,6 +376,19 @@ func (c *Client) getOHLCVResponseFromApi(url string) (*CryptoResponse, error) {
 	return &cr, nil
 }
 
+// sleepContext pauses for d, returning early with ctx.Err() if ctx is done first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
 func isVolumeFromZeroInDataSet(data []OHLCVData) bool {
 	for _, d := range data {
 		if !d.VolumeFrom.IsZero() {
@@ -1,10 +1,19 @@
 package cryptocompare
 
 import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestRemoveNotReadyData(t *testing.T) {
@@ -162,3 +171,238 @@ func TestSortByTime(t *testing.T) {
 			})
 	}
 }
+
+func TestSleepContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := sleepContext(ctx, time.Hour)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	err = sleepContext(context.Background(), time.Millisecond)
+	assert.NoError(t, err)
+}
+
+// newTestClient creates a Client talking to a fake CryptoCompare server which
+// serves pages from the given handler, pausing between pages is recorded instead of slept
+func newTestClient(t *testing.T, handler http.HandlerFunc, sleeps *[]time.Duration) *Client {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	logger := logrus.New()
+	logger.Out = io.Discard
+
+	return NewClient("test-key", logger,
+		WithBaseURL(server.URL),
+		WithHTTPClient(server.Client()),
+		WithClock(func() time.Time { return time.Unix(1000, 0) }),
+		WithSleeper(func(ctx context.Context, d time.Duration) error {
+			*sleeps = append(*sleeps, d)
+			return ctx.Err()
+		}),
+	)
+}
+
+func writeTestResponse(t *testing.T, w http.ResponseWriter, timeFrom int64, data []OHLCVData) {
+	t.Helper()
+
+	var resp CryptoResponse
+	resp.Response = "Success"
+	resp.Data.TimeFrom = timeFrom
+	resp.Data.Data = data
+	require.NoError(t, json.NewEncoder(w).Encode(resp))
+}
+
+func TestFetchAllOHLCVDataPagination(t *testing.T) {
+	var toTsSeen []int64
+	var sleeps []time.Duration
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/histohour", r.URL.Path)
+		assert.Equal(t, "test-key", r.URL.Query().Get("api_key"))
+
+		toTs, err := strconv.ParseInt(r.URL.Query().Get("toTs"), 10, 64)
+		require.NoError(t, err)
+		toTsSeen = append(toTsSeen, toTs)
+
+		switch len(toTsSeen) {
+		case 1:
+			writeTestResponse(t, w, 20, []OHLCVData{
+				{Time: 20, VolumeFrom: decimal.NewFromInt(1)},
+				{Time: 30, VolumeFrom: decimal.NewFromInt(2)},
+			})
+		case 2:
+			writeTestResponse(t, w, 0, []OHLCVData{
+				{Time: 0, VolumeFrom: decimal.NewFromInt(3)},
+				{Time: 10, VolumeFrom: decimal.NewFromInt(4)},
+			})
+		default:
+			// fake dataset returned by the API before the genesis of the pair
+			writeTestResponse(t, w, -20, []OHLCVData{
+				{Time: -20, VolumeFrom: decimal.Zero},
+				{Time: -10, VolumeFrom: decimal.Zero},
+			})
+		}
+	}, &sleeps)
+
+	data, err := client.FetchAllHourlyOHLCVData("BTC", "USD")
+	require.NoError(t, err)
+
+	assert.Equal(t, []int64{1005, 19, -1}, toTsSeen)
+	assert.Equal(t, []time.Duration{10 * time.Second, 10 * time.Second}, sleeps)
+
+	times := make([]int64, len(data))
+	for i, d := range data {
+		times[i] = d.Time
+	}
+	assert.Equal(t, []int64{0, 10, 20, 30}, times)
+}
+
+func TestFetchAllOHLCVDataReturnsPartialDataOnError(t *testing.T) {
+	var sleeps []time.Duration
+	requests := 0
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			writeTestResponse(t, w, 20, []OHLCVData{
+				{Time: 20, VolumeFrom: decimal.NewFromInt(1)},
+			})
+			return
+		}
+		_, _ = w.Write([]byte(`{"Response":"Error","Message":"something went wrong"}`))
+	}, &sleeps)
+
+	data, err := client.FetchAllDailyOHLCVData("BTC", "USD")
+	assert.Error(t, err)
+	assert.Len(t, data, 1)
+}
+
+func TestFetchAllOHLCVDataCancelled(t *testing.T) {
+	var sleeps []time.Duration
+	ctx, cancel := context.WithCancel(context.Background())
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeTestResponse(t, w, 20, []OHLCVData{
+			{Time: 20, VolumeFrom: decimal.NewFromInt(1)},
+		})
+	}, &sleeps)
+	// cancel while the client pauses before the next page
+	WithSleeper(func(ctx context.Context, d time.Duration) error {
+		cancel()
+		return sleepContext(ctx, d)
+	})(client)
+
+	data, err := client.FetchAllDailyOHLCVDataContext(ctx, "BTC", "USD")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Len(t, data, 1)
+}
+
+func TestFetchOHLCVDataWithLimit(t *testing.T) {
+	var sleeps []time.Duration
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/histominute", r.URL.Path)
+		assert.Equal(t, "2", r.URL.Query().Get("limit"))
+		writeTestResponse(t, w, 0, []OHLCVData{
+			{Time: 0, VolumeFrom: decimal.NewFromInt(1)},
+			{Time: 60, VolumeFrom: decimal.NewFromInt(1)},
+			{Time: 120, VolumeFrom: decimal.Zero},
+		})
+	}, &sleeps)
+
+	data, err := client.FetchMinuteOHLCVData("BTC", "USD", 2)
+	require.NoError(t, err)
+	assert.Len(t, data, 2)
+	assert.Empty(t, sleeps)
+}
+
+func TestGetOHLCVResponseFromApiRetry(t *testing.T) {
+	var sleeps []time.Duration
+	requests := 0
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch requests {
+		case 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case 2:
+			_, _ = w.Write([]byte(`{"Response":"Error","Message":"You are over your rate limit please upgrade your account!"}`))
+		default:
+			writeTestResponse(t, w, 0, []OHLCVData{
+				{Time: 0, VolumeFrom: decimal.NewFromInt(1)},
+			})
+		}
+	}, &sleeps)
+	WithRetry(3, time.Second, 4*time.Second)(client)
+
+	data, err := client.FetchDailyOHLCVData("BTC", "USD", 1)
+	require.NoError(t, err)
+	assert.Len(t, data, 1)
+	assert.Equal(t, 3, requests)
+	require.Len(t, sleeps, 2)
+	assert.LessOrEqual(t, sleeps[0], time.Second)
+	assert.LessOrEqual(t, sleeps[1], 2*time.Second)
+}
+
+func TestGetOHLCVResponseFromApiNoRetryOnConfigError(t *testing.T) {
+	var sleeps []time.Duration
+	requests := 0
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write([]byte(`{"Response":"Error","Message":"You need a valid auth key or api key to access this endpoint"}`))
+	}, &sleeps)
+
+	_, err := client.FetchDailyOHLCVData("BTC", "USD", 1)
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+	assert.Equal(t, 1, requests)
+	assert.Empty(t, sleeps)
+}
+
+func TestGetOHLCVResponseFromApiRetriesExhausted(t *testing.T) {
+	var sleeps []time.Duration
+	requests := 0
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}, &sleeps)
+	WithRetry(2, time.Second, time.Second)(client)
+
+	_, err := client.FetchDailyOHLCVData("BTC", "USD", 1)
+	assert.ErrorIs(t, err, ErrServerError)
+	assert.Equal(t, 3, requests)
+	assert.Len(t, sleeps, 2)
+}
+
+func TestWithRetryKeepsDefaultDelays(t *testing.T) {
+	client := NewClient("", nil, WithRetry(5, 0, 0))
+	assert.Equal(t, 5, client.maxRetries)
+	assert.Equal(t, defaultRetryBaseDelay, client.retryBaseDelay)
+	assert.Equal(t, defaultRetryMaxDelay, client.retryMaxDelay)
+
+	client = NewClient("", nil, WithRetry(0, 2*time.Second, 0))
+	assert.Equal(t, 0, client.maxRetries)
+	assert.Equal(t, 2*time.Second, client.retryBaseDelay)
+	assert.Equal(t, defaultRetryMaxDelay, client.retryMaxDelay)
+}
+
+func TestForExchange(t *testing.T) {
+	var sleeps []time.Duration
+	var exchanges []string
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		exchanges = append(exchanges, r.URL.Query().Get("e"))
+		writeTestResponse(t, w, 0, nil)
+	}, &sleeps)
+
+	_, err := client.ForExchange("Binance").FetchHourlyOHLCVData("BTC", "USDT", 1)
+	require.NoError(t, err)
+	_, err = client.FetchHourlyOHLCVData("BTC", "USD", 1)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"Binance", ""}, exchanges)
+}
@@ -0,0 +1,49 @@
+package cryptocompare
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+var (
+	// ErrRateLimited is returned when the API rejects a request because the rate limit is exceeded
+	ErrRateLimited = errors.New("cryptocompare: rate limit exceeded")
+	// ErrUnknownMarket is returned when the requested trading pair or exchange does not exist
+	ErrUnknownMarket = errors.New("cryptocompare: unknown market")
+	// ErrInvalidAPIKey is returned when the API key is missing or rejected
+	ErrInvalidAPIKey = errors.New("cryptocompare: invalid api key")
+	// ErrServerError is returned when the API responds with a 5xx status code
+	ErrServerError = errors.New("cryptocompare: server error")
+)
+
+// parseAPIError maps the Message of an error response to one of the sentinel errors,
+// messages that are not recognized are returned as plain errors
+func parseAPIError(message string) error {
+	msg := strings.ToLower(message)
+
+	switch {
+	case strings.Contains(msg, "rate limit"):
+		return fmt.Errorf("%w: %s", ErrRateLimited, message)
+	case strings.Contains(msg, "api key"), strings.Contains(msg, "api_key"), strings.Contains(msg, "auth key"):
+		return fmt.Errorf("%w: %s", ErrInvalidAPIKey, message)
+	case strings.Contains(msg, "market does not exist"),
+		strings.Contains(msg, "there is no data for the symbol"),
+		strings.Contains(msg, "there is no data for the tosymbol"),
+		strings.Contains(msg, "does not trade"):
+		return fmt.Errorf("%w: %s", ErrUnknownMarket, message)
+	default:
+		return fmt.Errorf("error fetching data: %s", message)
+	}
+}
+
+// isRetryable reports whether err is a transient failure worth retrying
+func isRetryable(err error) bool {
+	if errors.Is(err, ErrRateLimited) || errors.Is(err, ErrServerError) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,66 @@
+package cryptocompare
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestParseAPIError(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    error
+	}{
+		{
+			name:    "rate limited",
+			message: "You are over your rate limit please upgrade your account!",
+			want:    ErrRateLimited,
+		},
+		{
+			name:    "invalid api key",
+			message: "You need a valid auth key or api key to access this endpoint",
+			want:    ErrInvalidAPIKey,
+		},
+		{
+			name:    "unknown market",
+			message: "cccagg_or_exchange market does not exist for this coin pair (FOO-USD)",
+			want:    ErrUnknownMarket,
+		},
+		{
+			name:    "no data for symbol",
+			message: "There is no data for the symbol FOO .",
+			want:    ErrUnknownMarket,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := parseAPIError(tt.message)
+			assert.ErrorIs(t, err, tt.want)
+			assert.Contains(t, err.Error(), tt.message)
+		})
+	}
+
+	err := parseAPIError("something went wrong")
+	for _, sentinel := range []error{ErrRateLimited, ErrInvalidAPIKey, ErrUnknownMarket, ErrServerError} {
+		assert.NotErrorIs(t, err, sentinel)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	assert.True(t, isRetryable(parseAPIError("rate limit")))
+	assert.True(t, isRetryable(ErrServerError))
+	assert.True(t, isRetryable(timeoutError{}))
+	assert.False(t, isRetryable(parseAPIError("invalid api key")))
+	assert.False(t, isRetryable(context.Canceled))
+	assert.False(t, isRetryable(errors.New("something went wrong")))
+}
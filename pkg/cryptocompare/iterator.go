@@ -0,0 +1,134 @@
+package cryptocompare
+
+import (
+	"context"
+	"time"
+
+	"crypto_project/pkg/models"
+)
+
+// PageIterator walks the whole OHLCV history of a trading pair one API page at a
+// time, from the most recent page back to the oldest one. Bars within a page are
+// sorted by time. Use it like bufio.Scanner:
+//
+//	it := client.AllOHLCVDataPages(ctx, "BTC", "USD", models.TimeframeHourly)
+//	for it.Next() {
+//		save(it.Page())
+//	}
+//	if err := it.Err(); err != nil { ... }
+type PageIterator struct {
+	c             *Client
+	ctx           context.Context
+	tradingSymbol string
+	vsCurrency    string
+	timeframe     models.Timeframe
+	aggregate     int
+	endpoint      string
+	toTs          int64
+
+	page  []OHLCVData
+	pages int
+	done  bool
+	err   error
+}
+
+// AllOHLCVDataPages returns an iterator over all available OHLCV data of a trading pair,
+// the iteration stops early when ctx is done
+func (c *Client) AllOHLCVDataPages(ctx context.Context, tradingSymbol, vsCurrency string, timeframe models.Timeframe) *PageIterator {
+	return c.AllAggregatedOHLCVDataPages(ctx, tradingSymbol, vsCurrency, models.BarWidth{Timeframe: timeframe, Aggregate: 1})
+}
+
+// AllAggregatedOHLCVDataPages is like AllOHLCVDataPages but iterates over bars of the given width
+func (c *Client) AllAggregatedOHLCVDataPages(ctx context.Context, tradingSymbol, vsCurrency string, width models.BarWidth) *PageIterator {
+	it := &PageIterator{
+		c:             c,
+		ctx:           ctx,
+		tradingSymbol: tradingSymbol,
+		vsCurrency:    vsCurrency,
+		timeframe:     width.Timeframe,
+		aggregate:     width.Aggregate,
+		// Add 5 seconds to avoid losing data due to time difference
+		toTs: c.now().Unix() + 5,
+	}
+	it.endpoint, it.err = histoEndpoint(width.Timeframe)
+	it.done = it.err != nil
+	return it
+}
+
+// Next fetches the next page, it returns false when there is no more data or an error occurred
+func (it *PageIterator) Next() bool {
+	if it.done {
+		return false
+	}
+
+	c := it.c
+	if it.pages > 0 && c.limiter == nil {
+		c.logger.Debugf("Pause before next page of %s/%s...", it.tradingSymbol, it.vsCurrency)
+		if err := c.sleep(it.ctx, 10*time.Second); err != nil {
+			c.logger.Warnf("Fetching pages of %s/%s cancelled during pause: %v", it.tradingSymbol, it.vsCurrency, err)
+			return it.stop(err)
+		}
+	}
+
+	c.logger.Debugf("Fetching more data for %s/%s, toTs: %s",
+		it.tradingSymbol, it.vsCurrency, time.Unix(it.toTs, 0).In(time.UTC).Format(time.RFC3339))
+
+	url := c.histoURL(it.endpoint, histoQuery{
+		tradingSymbol: it.tradingSymbol,
+		vsCurrency:    it.vsCurrency,
+		limit:         apiMaxLimit,
+		toTs:          it.toTs,
+		aggregate:     it.aggregate,
+	})
+	c.logger.Trace("URL: ", url)
+
+	resp, err := c.getOHLCVResponseFromApi(it.ctx, url)
+	if err != nil {
+		c.logger.Errorf("Error in getOHLCVResponseFromApi for %s/%s: %v", it.tradingSymbol, it.vsCurrency, err)
+		return it.stop(err)
+	}
+
+	data := resp.Data.Data
+	if len(data) == 0 {
+		c.logger.Tracef("No more data to fetch OHLCV history for %s/%s", it.tradingSymbol, it.vsCurrency)
+		return it.stop(nil)
+	}
+
+	if isVolumeFromZeroInDataSet(data) {
+		c.logger.Warnf("Encountered fake dataset for %s/%s, stop the iteration", it.tradingSymbol, it.vsCurrency)
+		return it.stop(nil)
+	}
+
+	sortByTime(data)
+	if it.pages == 0 && it.timeframe == models.TimeframeMinute {
+		// remove last row if it's not ready yet
+		data = removeNotReadyData(data)
+	}
+
+	it.page = data
+	it.pages++
+	it.toTs = resp.Data.TimeFrom - 1
+	return true
+}
+
+func (it *PageIterator) stop(err error) bool {
+	it.page = nil
+	it.done = true
+	it.err = err
+	return false
+}
+
+// Page returns the page fetched by the last call to Next
+func (it *PageIterator) Page() []OHLCVData {
+	return it.page
+}
+
+// Pages returns how many pages have been fetched so far
+func (it *PageIterator) Pages() int {
+	return it.pages
+}
+
+// Err returns the error which stopped the iteration, nil if all data has been fetched
+func (it *PageIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,65 @@
+package cryptocompare
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+
+	"crypto_project/pkg/models"
+)
+
+func TestPageIterator(t *testing.T) {
+	var sleeps []time.Duration
+	requests := 0
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch requests {
+		case 1:
+			writeTestResponse(t, w, 120, []OHLCVData{
+				{Time: 180, VolumeFrom: decimal.NewFromInt(1)},
+				{Time: 120, VolumeFrom: decimal.NewFromInt(1)},
+				{Time: 240, VolumeFrom: decimal.Zero},
+			})
+		case 2:
+			writeTestResponse(t, w, 0, []OHLCVData{
+				{Time: 0, VolumeFrom: decimal.NewFromInt(1)},
+				{Time: 60, VolumeFrom: decimal.NewFromInt(1)},
+			})
+		default:
+			writeTestResponse(t, w, 0, nil)
+		}
+	}, &sleeps)
+
+	var pages [][]int64
+	it := client.AllOHLCVDataPages(context.Background(), "BTC", "USD", models.TimeframeMinute)
+	for it.Next() {
+		var times []int64
+		for _, d := range it.Page() {
+			times = append(times, d.Time)
+		}
+		pages = append(pages, times)
+	}
+
+	assert.NoError(t, it.Err())
+	assert.Equal(t, 2, it.Pages())
+	// the not ready bar is removed from the most recent page only
+	assert.Equal(t, [][]int64{{120, 180}, {0, 60}}, pages)
+	assert.Len(t, sleeps, 2)
+	assert.False(t, it.Next())
+}
+
+func TestPageIteratorInvalidTimeframe(t *testing.T) {
+	var sleeps []time.Duration
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("no request expected")
+	}, &sleeps)
+
+	it := client.AllOHLCVDataPages(context.Background(), "BTC", "USD", models.Timeframe("weekly"))
+	assert.False(t, it.Next())
+	assert.Error(t, it.Err())
+}
@@ -0,0 +1,153 @@
+package cryptocompare
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"crypto_project/pkg/models"
+)
+
+// histoEndpoint returns the histo endpoint serving bars of the timeframe
+func histoEndpoint(tf models.Timeframe) (string, error) {
+	switch tf {
+	case models.TimeframeMinute:
+		return histominuteEndpoint, nil
+	case models.TimeframeHourly:
+		return histohourEndpoint, nil
+	case models.TimeframeDaily:
+		return histodayEndpoint, nil
+	default:
+		return "", fmt.Errorf("invalid timeframe: %s", tf)
+	}
+}
+
+// FetchOHLCVRange fetches bars whose time is in [from, to), it returns them with the number of pages fetched
+func (c *Client) FetchOHLCVRange(tradingSymbol, vsCurrency string, timeframe models.Timeframe, from, to time.Time) ([]OHLCVData, int, error) {
+	return c.FetchOHLCVRangeContext(context.Background(), tradingSymbol, vsCurrency, timeframe, from, to)
+}
+
+// FetchOHLCVRangeContext is like FetchOHLCVRange but stops when ctx is done,
+// returning the data fetched so far along with the context error
+func (c *Client) FetchOHLCVRangeContext(ctx context.Context, tradingSymbol, vsCurrency string, timeframe models.Timeframe, from, to time.Time) ([]OHLCVData, int, error) {
+	return c.fetchOHLCVRange(ctx, tradingSymbol, vsCurrency, models.BarWidth{Timeframe: timeframe, Aggregate: 1}, from, to)
+}
+
+// FetchAggregatedOHLCVRange fetches bars of the given width whose time is in [from, to), it returns
+// them with the number of pages fetched
+func (c *Client) FetchAggregatedOHLCVRange(tradingSymbol, vsCurrency string, width models.BarWidth, from, to time.Time) ([]OHLCVData, int, error) {
+	return c.FetchAggregatedOHLCVRangeContext(context.Background(), tradingSymbol, vsCurrency, width, from, to)
+}
+
+// FetchAggregatedOHLCVRangeContext is like FetchAggregatedOHLCVRange but stops when ctx is done,
+// returning the data fetched so far along with the context error
+func (c *Client) FetchAggregatedOHLCVRangeContext(ctx context.Context, tradingSymbol, vsCurrency string, width models.BarWidth, from, to time.Time) ([]OHLCVData, int, error) {
+	return c.fetchOHLCVRange(ctx, tradingSymbol, vsCurrency, width, from, to)
+}
+
+// fetchOHLCVRange pages backwards from to with toTs until from is covered
+func (c *Client) fetchOHLCVRange(ctx context.Context, tradingSymbol, vsCurrency string, width models.BarWidth, from, to time.Time) ([]OHLCVData, int, error) {
+	endpoint, err := histoEndpoint(width.Timeframe)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	fromTs, toTs := from.Unix(), to.Unix()-1
+	if toTs < fromTs {
+		return nil, 0, nil
+	}
+
+	c.logger.Infof("Starting fetchOHLCVRange request for %s/%s, bar width: %s, from: %s, to: %s",
+		tradingSymbol, vsCurrency, width, from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339))
+
+	var allData []OHLCVData
+	pages := 0
+	for {
+		// The API returns limit+1 bars ending at the bar containing toTs
+		limit := (toTs - fromTs) / width.Seconds()
+		if limit > apiMaxLimit {
+			limit = apiMaxLimit
+		} else if limit < 1 {
+			limit = 1
+		}
+
+		url := c.histoURL(endpoint, histoQuery{
+			tradingSymbol: tradingSymbol,
+			vsCurrency:    vsCurrency,
+			limit:         limit,
+			toTs:          toTs,
+			aggregate:     width.Aggregate,
+		})
+
+		var resp *CryptoResponse
+		resp, err = c.getOHLCVResponseFromApi(ctx, url)
+		if err != nil {
+			c.logger.Errorf("Error in getOHLCVResponseFromApi for %s/%s: %v", tradingSymbol, vsCurrency, err)
+			break
+		}
+
+		data := resp.Data.Data
+		if len(data) == 0 || isVolumeFromZeroInDataSet(data) {
+			c.logger.Tracef("No more data to fetch OHLCV range for %s/%s", tradingSymbol, vsCurrency)
+			break
+		}
+
+		allData = append(allData, data...)
+		pages++
+		if resp.Data.TimeFrom <= fromTs {
+			break
+		}
+		toTs = resp.Data.TimeFrom - 1
+
+		if c.limiter == nil {
+			c.logger.Debugf("Pause before next fetchOHLCVRange iteration for %s/%s...", tradingSymbol, vsCurrency)
+			if err = c.sleep(ctx, 10*time.Second); err != nil {
+				break
+			}
+		}
+	}
+
+	sortByTime(allData)
+	allData = dedupeByTime(allData)
+	if width.Timeframe == models.TimeframeMinute {
+		// remove last row if it's not ready yet
+		allData = removeNotReadyData(allData)
+	}
+	allData = trimToRange(allData, from.Unix(), to.Unix())
+
+	if err != nil {
+		c.logger.Warnf("fetchOHLCVRange request for %s/%s breaked early, return data it fetched so far, pages: %d, len: %d", tradingSymbol, vsCurrency, pages, len(allData))
+	} else {
+		c.logger.Infof("Completed fetchOHLCVRange request for %s/%s, pages: %d, len: %d", tradingSymbol, vsCurrency, pages, len(allData))
+	}
+
+	return allData, pages, err
+}
+
+// dedupeByTime removes bars with the same time as the bar before them, data must be sorted
+func dedupeByTime(data []OHLCVData) []OHLCVData {
+	if len(data) == 0 {
+		return data
+	}
+
+	result := data[:1]
+	for _, d := range data[1:] {
+		if d.Time != result[len(result)-1].Time {
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
+// trimToRange keeps bars whose time is in [fromTs, toTs), data must be sorted
+func trimToRange(data []OHLCVData, fromTs, toTs int64) []OHLCVData {
+	start := 0
+	for start < len(data) && data[start].Time < fromTs {
+		start++
+	}
+	end := len(data)
+	for end > start && data[end-1].Time >= toTs {
+		end--
+	}
+	return data[start:end]
+}
@@ -0,0 +1,130 @@
+package cryptocompare
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"crypto_project/pkg/models"
+)
+
+func TestFetchOHLCVRange(t *testing.T) {
+	var sleeps []time.Duration
+	type request struct{ limit, toTs int64 }
+	var requests []request
+
+	// serves hourly bars from 0 to 10h, each page ends at the bar containing toTs
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/histohour", r.URL.Path)
+		limit, err := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64)
+		require.NoError(t, err)
+		toTs, err := strconv.ParseInt(r.URL.Query().Get("toTs"), 10, 64)
+		require.NoError(t, err)
+		requests = append(requests, request{limit, toTs})
+
+		last := toTs - toTs%3600
+		first := last - limit*3600
+		// pages overlap by one bar to check de-duplication
+		if len(requests) > 1 {
+			last += 3600
+		}
+		var data []OHLCVData
+		for ts := first; ts <= last; ts += 3600 {
+			data = append(data, OHLCVData{Time: ts, VolumeFrom: decimal.NewFromInt(1)})
+		}
+		writeTestResponse(t, w, first, data)
+	}, &sleeps)
+
+	from := time.Unix(2*3600+30, 0)
+	to := time.Unix(8*3600, 0)
+	data, pages, err := client.FetchOHLCVRange("BTC", "USD", models.TimeframeHourly, from, to)
+	require.NoError(t, err)
+	assert.Equal(t, 1, pages)
+
+	times := make([]int64, len(data))
+	for i, d := range data {
+		times[i] = d.Time / 3600
+	}
+	assert.Equal(t, []int64{3, 4, 5, 6, 7}, times)
+	require.Len(t, requests, 1)
+	assert.Equal(t, request{limit: 5, toTs: 8*3600 - 1}, requests[0])
+}
+
+func TestFetchOHLCVRangePaging(t *testing.T) {
+	var sleeps []time.Duration
+	var toTsSeen []int64
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		toTs, err := strconv.ParseInt(r.URL.Query().Get("toTs"), 10, 64)
+		require.NoError(t, err)
+		toTsSeen = append(toTsSeen, toTs)
+
+		// every page holds 2 daily bars
+		last := toTs - toTs%86400
+		first := last - 86400
+		writeTestResponse(t, w, first, []OHLCVData{
+			{Time: first, VolumeFrom: decimal.NewFromInt(1)},
+			{Time: last, VolumeFrom: decimal.NewFromInt(1)},
+		})
+	}, &sleeps)
+
+	data, pages, err := client.FetchOHLCVRange("BTC", "USD", models.TimeframeDaily, time.Unix(86400, 0), time.Unix(5*86400, 0))
+	require.NoError(t, err)
+	assert.Len(t, data, 4)
+	assert.Equal(t, 2, pages)
+	assert.Equal(t, []int64{5*86400 - 1, 3*86400 - 1}, toTsSeen)
+	assert.Len(t, sleeps, 1)
+}
+
+func TestFetchOHLCVRangeInvalidTimeframe(t *testing.T) {
+	var sleeps []time.Duration
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("no request expected")
+	}, &sleeps)
+
+	_, _, err := client.FetchOHLCVRange("BTC", "USD", models.Timeframe("weekly"), time.Unix(0, 0), time.Unix(86400, 0))
+	assert.Error(t, err)
+}
+
+func TestDedupeByTime(t *testing.T) {
+	data := []OHLCVData{{Time: 1}, {Time: 1}, {Time: 2}, {Time: 3}, {Time: 3}}
+	assert.Equal(t, []OHLCVData{{Time: 1}, {Time: 2}, {Time: 3}}, dedupeByTime(data))
+	assert.Empty(t, dedupeByTime(nil))
+}
+
+func TestFetchAggregatedOHLCVRange(t *testing.T) {
+	var sleeps []time.Duration
+	const width = 4 * 3600
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/histohour", r.URL.Path)
+		assert.Equal(t, "4", r.URL.Query().Get("aggregate"))
+		limit, err := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64)
+		require.NoError(t, err)
+		toTs, err := strconv.ParseInt(r.URL.Query().Get("toTs"), 10, 64)
+		require.NoError(t, err)
+
+		last := toTs - toTs%width
+		first := last - limit*width
+		var data []OHLCVData
+		for ts := first; ts <= last; ts += width {
+			data = append(data, OHLCVData{Time: ts, VolumeFrom: decimal.NewFromInt(1)})
+		}
+		writeTestResponse(t, w, first, data)
+	}, &sleeps)
+
+	data, _, err := client.FetchAggregatedOHLCVRange("BTC", "USD", models.BarWidth{Timeframe: models.TimeframeHourly, Aggregate: 4},
+		time.Unix(2*width, 0), time.Unix(5*width, 0))
+	require.NoError(t, err)
+
+	times := make([]int64, len(data))
+	for i, d := range data {
+		times[i] = d.Time / width
+	}
+	assert.Equal(t, []int64{2, 3, 4}, times)
+}
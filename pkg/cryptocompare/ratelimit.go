@@ -0,0 +1,229 @@
+package cryptocompare
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRateLimitURL = "https://min-api.cryptocompare.com/stats/rate/limit"
+
+	// month is approximated as 30 days when refilling the monthly budget
+	month = 30 * 24 * time.Hour
+)
+
+// RateLimit is the number of API calls allowed per time window, 0 means no limit for that window
+type RateLimit struct {
+	PerSecond int
+	PerMinute int
+	PerHour   int
+	PerDay    int
+	PerMonth  int
+}
+
+// NeedsSync reports whether the limit has a daily or monthly budget. The calls made in these
+// windows outlive a process, so a RateLimiter only respects them once synced with the calls left
+// reported by the API, otherwise every process start would get the whole budget again.
+func (r RateLimit) NeedsSync() bool {
+	return r.PerDay > 0 || r.PerMonth > 0
+}
+
+// RateLimitCalls is the number of API calls of each time window
+type RateLimitCalls struct {
+	Second int `json:"second"`
+	Minute int `json:"minute"`
+	Hour   int `json:"hour"`
+	Day    int `json:"day"`
+	Month  int `json:"month"`
+}
+
+// RateLimitResponse is the response of the /stats/rate/limit endpoint
+type RateLimitResponse struct {
+	Response string `json:"Response"`
+	Message  string `json:"Message"`
+	Data     struct {
+		CallsMade RateLimitCalls `json:"calls_made"`
+		CallsLeft RateLimitCalls `json:"calls_left"`
+	} `json:"Data"`
+}
+
+// tokenBucket holds up to capacity tokens and refills them evenly over window
+type tokenBucket struct {
+	window   time.Duration
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+func (b *tokenBucket) rate() float64 {
+	return b.capacity / b.window.Seconds()
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.rate()
+		if b.tokens > b.capacity {
+			b.tokens = b.capacity
+		}
+	}
+	b.last = now
+}
+
+// wait returns how long it takes until a token is available
+func (b *tokenBucket) wait() time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate() * float64(time.Second))
+}
+
+// RateLimiter is a set of token buckets, one per time window, an API call is
+// allowed only when every bucket has a token. It is safe for concurrent use, so
+// one RateLimiter should be shared by all clients using the same API key.
+type RateLimiter struct {
+	mu      sync.Mutex
+	buckets map[time.Duration]*tokenBucket
+	now     func() time.Time
+	sleep   func(ctx context.Context, d time.Duration) error
+}
+
+// NewRateLimiter creates a RateLimiter allowing the given number of calls per time window. Every
+// bucket starts full, a limit which NeedsSync has to be synced with Sync before it is used.
+func NewRateLimiter(limit RateLimit) *RateLimiter {
+	l := &RateLimiter{
+		buckets: make(map[time.Duration]*tokenBucket),
+		now:     time.Now,
+		sleep:   sleepContext,
+	}
+	l.setLimit(time.Second, limit.PerSecond, limit.PerSecond)
+	l.setLimit(time.Minute, limit.PerMinute, limit.PerMinute)
+	l.setLimit(time.Hour, limit.PerHour, limit.PerHour)
+	l.setLimit(24*time.Hour, limit.PerDay, limit.PerDay)
+	l.setLimit(month, limit.PerMonth, limit.PerMonth)
+	return l
+}
+
+// setLimit sets capacity and available tokens of the bucket of window, capacity 0 removes the bucket
+func (l *RateLimiter) setLimit(window time.Duration, capacity int, tokens int) {
+	if capacity <= 0 {
+		delete(l.buckets, window)
+		return
+	}
+	if tokens > capacity {
+		tokens = capacity
+	}
+	l.buckets[window] = &tokenBucket{
+		window:   window,
+		capacity: float64(capacity),
+		tokens:   float64(tokens),
+		last:     l.now(),
+	}
+}
+
+// Sync lowers the available tokens to the calls left reported by the API, windows
+// without a configured limit take the plan quota (calls made + calls left) as limit
+func (l *RateLimiter) Sync(stats *RateLimitResponse) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	made, left := stats.Data.CallsMade, stats.Data.CallsLeft
+	windows := []struct {
+		window time.Duration
+		made   int
+		left   int
+	}{
+		{time.Second, made.Second, left.Second},
+		{time.Minute, made.Minute, left.Minute},
+		{time.Hour, made.Hour, left.Hour},
+		{24 * time.Hour, made.Day, left.Day},
+		{month, made.Month, left.Month},
+	}
+
+	for _, w := range windows {
+		if b, ok := l.buckets[w.window]; ok {
+			b.refill(l.now())
+			if float64(w.left) < b.tokens {
+				b.tokens = float64(w.left)
+			}
+		} else if w.made+w.left > 0 {
+			l.setLimit(w.window, w.made+w.left, w.left)
+		}
+	}
+}
+
+// Wait blocks until an API call is allowed by every time window, or ctx is done
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		now := l.now()
+		var wait time.Duration
+		for _, b := range l.buckets {
+			b.refill(now)
+			if w := b.wait(); w > wait {
+				wait = w
+			}
+		}
+		if wait == 0 {
+			for _, b := range l.buckets {
+				b.tokens--
+			}
+			l.mu.Unlock()
+			return nil
+		}
+		l.mu.Unlock()
+
+		if err := l.sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// WithRateLimiter makes the client wait for limiter before each API call, the
+// fixed pause between pages of fetch-all requests is skipped in favor of it
+func WithRateLimiter(limiter *RateLimiter) Option {
+	return func(c *Client) {
+		c.limiter = limiter
+	}
+}
+
+// WithRateLimitURL overrides the URL of the rate limit stats endpoint
+func WithRateLimitURL(url string) Option {
+	return func(c *Client) {
+		c.rateLimitURL = url
+	}
+}
+
+// FetchRateLimitContext fetches the calls made and left of the API key from the /stats/rate/limit endpoint
+func (c *Client) FetchRateLimitContext(ctx context.Context) (*RateLimitResponse, error) {
+	url := fmt.Sprintf("%s?api_key=%s", c.rateLimitURL, c.apiKey)
+	c.logger.Debugf("Fetching rate limit stats from URL: %s", c.rateLimitURL)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		c.logger.Errorf("Error making HTTP GET request: %v", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var rr RateLimitResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rr); err != nil {
+		c.logger.Errorf("Error decoding HTTP response: %v", err)
+		return nil, err
+	}
+
+	if rr.Response == "Error" {
+		c.logger.Errorf("Error fetching rate limit stats: %s", rr.Message)
+		return nil, parseAPIError(rr.Message)
+	}
+
+	return &rr, nil
+}
@@ -0,0 +1,98 @@
+package cryptocompare
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRateLimiter creates a RateLimiter whose clock only advances when it sleeps
+func newTestRateLimiter(limit RateLimit, sleeps *[]time.Duration) *RateLimiter {
+	now := time.Unix(0, 0)
+	l := NewRateLimiter(limit)
+	l.now = func() time.Time { return now }
+	l.sleep = func(ctx context.Context, d time.Duration) error {
+		*sleeps = append(*sleeps, d)
+		now = now.Add(d)
+		return ctx.Err()
+	}
+	for _, b := range l.buckets {
+		b.last = now
+	}
+	return l
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	var sleeps []time.Duration
+	l := newTestRateLimiter(RateLimit{PerSecond: 2, PerMinute: 3}, &sleeps)
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, l.Wait(context.Background()))
+	}
+	assert.Empty(t, sleeps)
+
+	// per second bucket is empty, wait half a second for the next token
+	require.NoError(t, l.Wait(context.Background()))
+	assert.Equal(t, []time.Duration{500 * time.Millisecond}, sleeps)
+
+	// per minute bucket is empty, a token comes every 20 seconds
+	sleeps = nil
+	require.NoError(t, l.Wait(context.Background()))
+	require.Len(t, sleeps, 1)
+	assert.InDelta(t, 19.5, sleeps[0].Seconds(), 0.01)
+}
+
+func TestRateLimiterWaitCancelled(t *testing.T) {
+	var sleeps []time.Duration
+	l := newTestRateLimiter(RateLimit{PerSecond: 1}, &sleeps)
+
+	require.NoError(t, l.Wait(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, l.Wait(ctx), context.Canceled)
+}
+
+func TestRateLimiterSync(t *testing.T) {
+	var sleeps []time.Duration
+	l := newTestRateLimiter(RateLimit{PerSecond: 10}, &sleeps)
+
+	var stats RateLimitResponse
+	stats.Data.CallsMade = RateLimitCalls{Second: 9, Month: 99}
+	stats.Data.CallsLeft = RateLimitCalls{Second: 1, Month: 1}
+	l.Sync(&stats)
+
+	assert.Equal(t, 1.0, l.buckets[time.Second].tokens)
+	require.Contains(t, l.buckets, month)
+	assert.Equal(t, 100.0, l.buckets[month].capacity)
+	assert.Equal(t, 1.0, l.buckets[month].tokens)
+	assert.NotContains(t, l.buckets, time.Minute)
+}
+
+func TestRateLimitNeedsSync(t *testing.T) {
+	assert.False(t, RateLimit{}.NeedsSync())
+	assert.False(t, RateLimit{PerSecond: 20, PerMinute: 300, PerHour: 3000}.NeedsSync())
+	assert.True(t, RateLimit{PerDay: 7500}.NeedsSync())
+	assert.True(t, RateLimit{PerMonth: 100000}.NeedsSync())
+}
+
+func TestFetchRateLimit(t *testing.T) {
+	var sleeps []time.Duration
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/stats/rate/limit", r.URL.Path)
+		_, _ = w.Write([]byte(`{"Response":"Success","Data":{` +
+			`"calls_made":{"second":1,"minute":2,"hour":3,"day":4,"month":5},` +
+			`"calls_left":{"second":19,"minute":298,"hour":2997,"day":7996,"month":99995}}}`))
+	}, &sleeps)
+	WithRateLimitURL(client.baseURL + "/stats/rate/limit")(client)
+
+	stats, err := client.FetchRateLimitContext(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, RateLimitCalls{Second: 1, Minute: 2, Hour: 3, Day: 4, Month: 5}, stats.Data.CallsMade)
+	assert.Equal(t, 99995, stats.Data.CallsLeft.Month)
+}
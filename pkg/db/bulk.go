@@ -0,0 +1,120 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm/clause"
+
+	"crypto_project/pkg/models"
+)
+
+var (
+	ohlcvCopyColumns = []string{
+		"trading_symbol", "vs_currency", "exchange", "provider", "timestamp",
+		"open", "high", "low", "close", "volume_from", "volume_to",
+	}
+	aggregatedCopyColumns = append([]string{"bar_width"}, ohlcvCopyColumns...)
+)
+
+// bulkUpsert streams rows into a temporary staging table with COPY, then merges them into
+// table with a single INSERT ... SELECT ... ON CONFLICT DO UPDATE, all in one transaction.
+// runID is recorded with the revisions if it is not 0.
+func (db *DB) bulkUpsert(ctx context.Context, name string, table string, columns []string, conflictColumns []clause.Column, runID int64, rows [][]interface{}) (UpsertResult, error) {
+	var result UpsertResult
+	if len(rows) == 0 {
+		return result, nil
+	}
+	db.Logger.Tracef("Starting bulk saving %s data, len: %d", name, len(rows))
+
+	sqlDB, err := db.DB.DB()
+	if err != nil {
+		return result, err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		db.Logger.Errorf("Error getting connection for bulk saving %s data: %v", name, err)
+		return result, err
+	}
+	defer conn.Close()
+
+	err = conn.Raw(func(driverConn interface{}) error {
+		stdConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("bulk saving needs a pgx connection, got %T", driverConn)
+		}
+		return pgx.BeginFunc(ctx, stdConn.Conn(), func(tx pgx.Tx) error {
+			if runID != 0 {
+				if _, err := tx.Exec(ctx, "SELECT set_config($1, $2, true)", fetchRunIDSetting, strconv.FormatInt(runID, 10)); err != nil {
+					return err
+				}
+			}
+
+			staging := "staging_" + table
+			if _, err := tx.Exec(ctx, fmt.Sprintf(
+				`CREATE TEMP TABLE %s ON COMMIT DROP AS SELECT %s FROM %s WITH NO DATA`,
+				staging, strings.Join(columns, ", "), table)); err != nil {
+				return err
+			}
+			// numbers the rows in the order they are copied, the last row of a key wins
+			if _, err := tx.Exec(ctx, fmt.Sprintf(
+				`ALTER TABLE %s ADD COLUMN %s bigint GENERATED ALWAYS AS IDENTITY`, staging, stagingSeqColumn)); err != nil {
+				return err
+			}
+
+			if _, err := tx.CopyFrom(ctx, pgx.Identifier{staging}, columns, pgx.CopyFromRows(rows)); err != nil {
+				return err
+			}
+
+			var inserted, updated int
+			if err := tx.QueryRow(ctx, mergeStagingSQL(table, staging, columns, conflictColumns)).Scan(&inserted, &updated); err != nil {
+				return err
+			}
+			// rows with the same key in the staging table are counted as unchanged
+			result = UpsertResult{Inserted: inserted, Updated: updated, Unchanged: len(rows) - inserted - updated}
+			return nil
+		})
+	})
+	if err != nil {
+		db.Logger.Errorf("Error bulk saving %s data: %v", name, err)
+		return UpsertResult{}, err
+	}
+
+	db.Logger.Tracef("Successfully bulk saved %s data, %s", name, result)
+	return result, nil
+}
+
+// stagingSeqColumn numbers the rows of a staging table in insertion order
+const stagingSeqColumn = "staging_seq"
+
+// mergeStagingSQL builds the statement merging the staging table into table, of the rows with
+// the same key in the staging table only the last one inserted is merged, since ON CONFLICT
+// cannot update a row twice
+func mergeStagingSQL(table, staging string, columns []string, conflictColumns []clause.Column) string {
+	keys := make([]string, len(conflictColumns))
+	for i, c := range conflictColumns {
+		keys[i] = c.Name
+	}
+
+	source := fmt.Sprintf("SELECT DISTINCT ON (%s) %s FROM %s ORDER BY %s, %s DESC",
+		strings.Join(keys, ", "), strings.Join(columns, ", "), staging, strings.Join(keys, ", "), stagingSeqColumn)
+	return upsertSQL(table, columns, source, conflictColumns)
+}
+
+func ohlcvCopyRow(d *models.CryptoOHLCV) []interface{} {
+	return []interface{}{
+		d.TradingSymbol, d.VsCurrency, d.Exchange, d.Provider, d.Timestamp,
+		numeric(d.Open), numeric(d.High), numeric(d.Low), numeric(d.Close), numeric(d.VolumeFrom), numeric(d.VolumeTo),
+	}
+}
+
+// numeric converts d to the type pgx encodes as a PostgreSQL numeric in COPY
+func numeric(d decimal.Decimal) pgtype.Numeric {
+	return pgtype.Numeric{Int: d.Coefficient(), Exp: d.Exponent(), Valid: true}
+}
@@ -0,0 +1,42 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeStagingSQL(t *testing.T) {
+	got := mergeStagingSQL("crypto_ohlcv_hourly_go", "staging_crypto_ohlcv_hourly_go", ohlcvCopyColumns, ohlcvConflictColumns)
+
+	want := `WITH upserted AS (INSERT INTO crypto_ohlcv_hourly_go AS t ` +
+		`(trading_symbol, vs_currency, exchange, provider, timestamp, open, high, low, close, volume_from, volume_to) ` +
+		`SELECT DISTINCT ON (trading_symbol, vs_currency, exchange, timestamp) ` +
+		`trading_symbol, vs_currency, exchange, provider, timestamp, open, high, low, close, volume_from, volume_to ` +
+		`FROM staging_crypto_ohlcv_hourly_go ` +
+		`ORDER BY trading_symbol, vs_currency, exchange, timestamp, staging_seq DESC ` +
+		`ON CONFLICT (trading_symbol, vs_currency, exchange, timestamp) DO UPDATE SET ` +
+		`open = EXCLUDED.open, high = EXCLUDED.high, low = EXCLUDED.low, close = EXCLUDED.close, ` +
+		`volume_from = EXCLUDED.volume_from, volume_to = EXCLUDED.volume_to, provider = EXCLUDED.provider ` +
+		`WHERE t.open IS DISTINCT FROM EXCLUDED.open OR t.high IS DISTINCT FROM EXCLUDED.high OR ` +
+		`t.low IS DISTINCT FROM EXCLUDED.low OR t.close IS DISTINCT FROM EXCLUDED.close OR ` +
+		`t.volume_from IS DISTINCT FROM EXCLUDED.volume_from OR t.volume_to IS DISTINCT FROM EXCLUDED.volume_to OR ` +
+		`t.provider IS DISTINCT FROM EXCLUDED.provider ` +
+		`RETURNING xmax = 0 AS inserted) ` +
+		`SELECT COUNT(*) FILTER (WHERE inserted), COUNT(*) FILTER (WHERE NOT inserted) FROM upserted`
+	assert.Equal(t, want, got)
+}
+
+func TestNumeric(t *testing.T) {
+	tests := []string{"0", "1", "-1.5", "12345.6789", "0.00000001"}
+
+	for _, tt := range tests {
+		t.Run(tt, func(t *testing.T) {
+			d := decimal.RequireFromString(tt)
+			n := numeric(d)
+			assert.True(t, n.Valid)
+			assert.True(t, d.Equal(decimal.NewFromBigInt(n.Int, n.Exp)))
+		})
+	}
+}
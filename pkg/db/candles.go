@@ -0,0 +1,183 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"crypto_project/pkg/models"
+)
+
+// candleTable holds the queries on the candles of one timeframe which work the same with
+// every storage backend. Times are passed in UTC, since SQLite compares them as text.
+type candleTable struct {
+	db   *DB
+	spec models.TimeframeSpec
+}
+
+// Timeframe returns the timeframe of the candles of the repository
+func (r *candleTable) Timeframe() models.Timeframe {
+	return r.spec.Timeframe
+}
+
+// Spec returns how the candles of the repository are stored
+func (r *candleTable) Spec() models.TimeframeSpec {
+	return r.spec
+}
+
+func (r *candleTable) conflictColumns() []clause.Column {
+	if r.spec.Aggregated() {
+		return aggregatedConflictColumns
+	}
+	return ohlcvConflictColumns
+}
+
+// Cursor is a position in a series for keyset pagination with Scan, the zero Cursor
+// is before the oldest candle
+type Cursor struct {
+	// After is the timestamp of the last candle already read
+	After time.Time
+}
+
+// Get returns up to limit of the oldest candles of a series ordered by timestamp, use Latest
+// for the most recent ones
+func (r *candleTable) Get(limit int, tradingSymbol string, vsCurrency string, exchange string) ([]models.CryptoOHLCV, error) {
+	query := r.series(tradingSymbol, vsCurrency, exchange).
+		Order("timestamp asc").
+		Limit(limit)
+
+	data, err := r.find(query)
+	if err != nil {
+		r.db.Logger.Errorf("Error getting %s data: %v", r.name(), err)
+		return nil, err
+	}
+	return data, nil
+}
+
+// Range returns the candles of a series with a timestamp in [from, to) ordered by timestamp
+func (r *candleTable) Range(tradingSymbol string, vsCurrency string, exchange string, from time.Time, to time.Time) ([]models.CryptoOHLCV, error) {
+	data, err := r.find(r.rangeQuery(tradingSymbol, vsCurrency, exchange, from, to))
+	if err != nil {
+		r.db.Logger.Errorf("Error getting %s data from %v to %v: %v", r.name(), from, to, err)
+		return nil, err
+	}
+	return data, nil
+}
+
+// Latest returns the n most recent candles of a series ordered by timestamp
+func (r *candleTable) Latest(n int, tradingSymbol string, vsCurrency string, exchange string) ([]models.CryptoOHLCV, error) {
+	data, err := r.find(r.latestQuery(n, tradingSymbol, vsCurrency, exchange))
+	if err != nil {
+		r.db.Logger.Errorf("Error getting latest %s data: %v", r.name(), err)
+		return nil, err
+	}
+
+	// the query returns the newest candle first
+	for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
+		data[i], data[j] = data[j], data[i]
+	}
+	return data, nil
+}
+
+// Scan returns the page of up to pageSize candles of a series following cursor, ordered by timestamp,
+// and the cursor of the next page. An empty page means the whole series has been read.
+//
+// Unlike offset pagination every page is an index range scan, so reading a big series page by
+// page stays fast and no candle is read twice. Of the candles inserted meanwhile only those after
+// the cursor are read, candles inserted behind it, e.g. by a repair or a backfill, are skipped.
+func (r *candleTable) Scan(tradingSymbol string, vsCurrency string, exchange string, cursor Cursor, pageSize int) ([]models.CryptoOHLCV, Cursor, error) {
+	data, err := r.find(r.scanQuery(tradingSymbol, vsCurrency, exchange, cursor, pageSize))
+	if err != nil {
+		r.db.Logger.Errorf("Error scanning %s data after %v: %v", r.name(), cursor.After, err)
+		return nil, cursor, err
+	}
+
+	if len(data) > 0 {
+		cursor = Cursor{After: data[len(data)-1].Timestamp}
+	}
+	return data, cursor, nil
+}
+
+func (r *candleTable) rangeQuery(tradingSymbol string, vsCurrency string, exchange string, from time.Time, to time.Time) *gorm.DB {
+	return r.series(tradingSymbol, vsCurrency, exchange).
+		Where("timestamp >= ? AND timestamp < ?", from.UTC(), to.UTC()).
+		Order("timestamp asc")
+}
+
+func (r *candleTable) latestQuery(n int, tradingSymbol string, vsCurrency string, exchange string) *gorm.DB {
+	return r.series(tradingSymbol, vsCurrency, exchange).
+		Order("timestamp desc").
+		Limit(n)
+}
+
+func (r *candleTable) scanQuery(tradingSymbol string, vsCurrency string, exchange string, cursor Cursor, pageSize int) *gorm.DB {
+	query := r.series(tradingSymbol, vsCurrency, exchange)
+	if !cursor.After.IsZero() {
+		query = query.Where("timestamp > ?", cursor.After.UTC())
+	}
+	return query.Order("timestamp asc").Limit(pageSize)
+}
+
+// series returns a query on the table of the repository filtered to one series
+func (r *candleTable) series(tradingSymbol string, vsCurrency string, exchange string) *gorm.DB {
+	query := r.db.Table(r.spec.Table).
+		Where("trading_symbol = ? AND vs_currency = ? AND exchange = ?", tradingSymbol, vsCurrency, exchange)
+	if r.spec.Aggregated() {
+		query = query.Where("bar_width = ?", r.spec.BarWidth)
+	}
+	return query
+}
+
+// find runs query and returns the candles it selects
+func (r *candleTable) find(query *gorm.DB) ([]models.CryptoOHLCV, error) {
+	if !r.spec.Aggregated() {
+		var data []models.CryptoOHLCV
+		if err := query.Find(&data).Error; err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+
+	var aggregated []models.CryptoOHLCVAggregated
+	if err := query.Find(&aggregated).Error; err != nil {
+		return nil, err
+	}
+	return fromAggregated(aggregated), nil
+}
+
+// name is the timeframe of the repository as used in log messages
+func (r *candleTable) name() string {
+	return string(r.spec.Timeframe)
+}
+
+// fromAggregated converts rows of the aggregated table to candles
+func fromAggregated(aggregated []models.CryptoOHLCVAggregated) []models.CryptoOHLCV {
+	data := make([]models.CryptoOHLCV, len(aggregated))
+	for i, d := range aggregated {
+		data[i] = models.CryptoOHLCV{
+			ID:            d.ID,
+			TradingSymbol: d.TradingSymbol,
+			VsCurrency:    d.VsCurrency,
+			Exchange:      d.Exchange,
+			Provider:      d.Provider,
+			Timestamp:     d.Timestamp,
+			Open:          d.Open,
+			High:          d.High,
+			Low:           d.Low,
+			Close:         d.Close,
+			VolumeFrom:    d.VolumeFrom,
+			VolumeTo:      d.VolumeTo,
+		}
+	}
+	return data
+}
+
+func (r *candleTable) seriesQuery() *gorm.DB {
+	query := r.db.Table(r.spec.Table).
+		Select("trading_symbol, vs_currency, exchange, MIN(timestamp) AS first, MAX(timestamp) AS last")
+	if r.spec.Aggregated() {
+		query = query.Where("bar_width = ?", r.spec.BarWidth)
+	}
+	return query.Group("trading_symbol, vs_currency, exchange").Order("trading_symbol, vs_currency, exchange")
+}
@@ -5,116 +5,73 @@ import (
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+)
+
+// defaultBatchSize keeps a batch of OHLCV rows well below the 65535 bind parameters limit of PostgreSQL
+const defaultBatchSize = 1000
 
-	"crypto_project/pkg/models"
+var (
+	ohlcvConflictColumns      = []clause.Column{{Name: "trading_symbol"}, {Name: "vs_currency"}, {Name: "exchange"}, {Name: "timestamp"}}
+	aggregatedConflictColumns = []clause.Column{{Name: "trading_symbol"}, {Name: "vs_currency"}, {Name: "exchange"}, {Name: "bar_width"}, {Name: "timestamp"}}
+	// ohlcvUpdateColumns are updated when an upserted row already exists
+	ohlcvUpdateColumns = []string{"open", "high", "low", "close", "volume_from", "volume_to", "provider"}
 )
 
 type DB struct {
 	*gorm.DB
 	Logger *logrus.Logger
-}
 
-func NewDB(dsn string, logger *logrus.Logger) (*DB, error) {
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
-	if err != nil {
-		logger.Errorf("Error connecting to database: %v", err)
-		return nil, err
-	}
-
-	db.AutoMigrate(&models.CryptoOHLCVMinute{}, &models.CryptoOHLCVHourly{}, &models.CryptoOHLCVDaily{})
-
-	return &DB{db, logger}, nil
+	batchSize       int
+	skipSchemaCheck bool
 }
 
-func (db *DB) UpsertMinuteOHLCData(data []models.CryptoOHLCVMinute) error {
-	db.Logger.Trace("Starting saving minute data")
-	clauses := db.Clauses(clause.OnConflict{
-		Columns: []clause.Column{{Name: "trading_symbol"}, {Name: "vs_currency"}, {Name: "timestamp"}},
-		DoUpdates: clause.AssignmentColumns([]string{
-			"open", "high", "low", "close", "volume_from", "volume_to",
-		}),
-	})
-	for _, d := range data {
-		if err := clauses.Create(&d).Error; err != nil {
-			db.Logger.Errorf("Error saving minute data: %v", err)
-			return err
+// Option configures optional settings of a DB
+type Option func(*DB)
+
+// WithBatchSize sets how many rows are sent in one INSERT statement when upserting
+func WithBatchSize(batchSize int) Option {
+	return func(db *DB) {
+		if batchSize > 0 {
+			db.batchSize = batchSize
 		}
 	}
-	db.Logger.Trace("Successfully saved minute data")
-	return nil
 }
 
-func (db *DB) UpsertHourlyOHLCData(data []models.CryptoOHLCVHourly) error {
-	db.Logger.Trace("Starting saving hourly data")
-	clauses := db.Clauses(clause.OnConflict{
-		Columns: []clause.Column{{Name: "trading_symbol"}, {Name: "vs_currency"}, {Name: "timestamp"}},
-		DoUpdates: clause.AssignmentColumns([]string{
-			"open", "high", "low", "close", "volume_from", "volume_to",
-		}),
-	})
-	for _, d := range data {
-		if err := clauses.Create(&d).Error; err != nil {
-			db.Logger.Errorf("Error saving hourly data: %v", err)
-			return err
-		}
+// WithoutSchemaCheck lets NewDB connect to a database with pending migrations, for running them
+func WithoutSchemaCheck() Option {
+	return func(db *DB) {
+		db.skipSchemaCheck = true
 	}
-	db.Logger.Trace("Successfully saved hourly data")
-	return nil
 }
 
-func (db *DB) UpsertDailyOHLCData(data []models.CryptoOHLCVDaily) error {
-	db.Logger.Trace("Starting saving daily data")
-	clauses := db.Clauses(clause.OnConflict{
-		Columns: []clause.Column{{Name: "trading_symbol"}, {Name: "vs_currency"}, {Name: "timestamp"}},
-		DoUpdates: clause.AssignmentColumns([]string{
-			"open", "high", "low", "close", "volume_from", "volume_to",
-		}),
-	})
-	for _, d := range data {
-		if err := clauses.Create(&d).Error; err != nil {
-			db.Logger.Errorf("Error saving daily data: %v", err)
-			return err
-		}
+// NewDB connects to the database, it returns an error wrapping ErrSchemaBehind if the
+// database has pending migrations unless WithoutSchemaCheck is given
+func NewDB(dsn string, logger *logrus.Logger, opts ...Option) (*DB, error) {
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		logger.Errorf("Error connecting to database: %v", err)
+		return nil, err
 	}
-	db.Logger.Trace("Successfully saved daily data")
-	return nil
-}
 
-func (db *DB) GetMinuteOHLCData(limit int, tradingSymbol string, vsCurrency string) ([]models.CryptoOHLCVMinute, error) {
-	var data []models.CryptoOHLCVMinute
-	result := db.Where("trading_symbol = ? AND vs_currency = ?", tradingSymbol, vsCurrency).
-		Order("timestamp asc").
-		Limit(limit).
-		Find(&data)
-	if result.Error != nil {
-		db.Logger.Errorf("Error getting minute data: %v", result.Error)
-		return nil, result.Error
+	d := &DB{DB: db, Logger: logger, batchSize: defaultBatchSize}
+	for _, opt := range opts {
+		opt(d)
 	}
-	return data, nil
-}
 
-func (db *DB) GetHourlyOHLCData(limit int, tradingSymbol string, vsCurrency string) ([]models.CryptoOHLCVHourly, error) {
-	var data []models.CryptoOHLCVHourly
-	result := db.Where("trading_symbol = ? AND vs_currency = ?", tradingSymbol, vsCurrency).
-		Order("timestamp asc").
-		Limit(limit).
-		Find(&data)
-	if result.Error != nil {
-		db.Logger.Errorf("Error getting hourly data: %v", result.Error)
-		return nil, result.Error
+	if !d.skipSchemaCheck {
+		if err := d.CheckSchema(); err != nil {
+			logger.Errorf("Error checking database schema: %v", err)
+			return nil, err
+		}
 	}
-	return data, nil
+	return d, nil
 }
 
-func (db *DB) GetDailyOHLCData(limit int, tradingSymbol string, vsCurrency string) ([]models.CryptoOHLCVDaily, error) {
-	var data []models.CryptoOHLCVDaily
-	result := db.Where("trading_symbol = ? AND vs_currency = ?", tradingSymbol, vsCurrency).
-		Order("timestamp asc").
-		Limit(limit).
-		Find(&data)
-	if result.Error != nil {
-		db.Logger.Errorf("Error getting daily data: %v", result.Error)
-		return nil, result.Error
+// Close closes the connections to the database
+func (db *DB) Close() error {
+	sqlDB, err := db.DB.DB()
+	if err != nil {
+		return err
 	}
-	return data, nil
+	return sqlDB.Close()
 }
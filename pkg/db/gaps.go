@@ -0,0 +1,88 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Series is a stored candle series of a repository with the time span it covers
+type Series struct {
+	TradingSymbol string
+	VsCurrency    string
+	Exchange      string
+	// First and Last are the timestamps of the oldest and the most recent candle
+	First time.Time
+	Last  time.Time
+}
+
+// Gap is a run of consecutive missing candles of a series
+type Gap struct {
+	// Start is the timestamp of the first missing candle
+	Start time.Time
+	// End is the timestamp following the last missing candle, the gap is [Start, End)
+	End time.Time
+	// Missing is how many candles are missing
+	Missing int
+}
+
+// Series returns every series stored in the repository
+func (r *Repository) Series() ([]Series, error) {
+	var series []Series
+	err := r.seriesQuery().Scan(&series).Error
+	if err != nil {
+		r.db.Logger.Errorf("Error listing %s series: %v", r.name(), err)
+		return nil, err
+	}
+	return series, nil
+}
+
+// Gaps returns the runs of candles missing from a series in [from, to), from is aligned down
+// to the interval of the repository
+func (r *Repository) Gaps(tradingSymbol string, vsCurrency string, exchange string, from time.Time, to time.Time) ([]Gap, error) {
+	from = from.Truncate(r.spec.Interval)
+	if !to.After(from) {
+		return nil, nil
+	}
+
+	var gaps []Gap
+	err := r.gapsQuery(tradingSymbol, vsCurrency, exchange, from, to).Scan(&gaps).Error
+	if err != nil {
+		r.db.Logger.Errorf("Error scanning %s gaps of %s/%s: %v", r.name(), tradingSymbol, vsCurrency, err)
+		return nil, err
+	}
+	return gaps, nil
+}
+
+// gapsQuery lists the expected timestamps with generate_series, keeps those without a candle,
+// then groups consecutive ones: their timestamp minus row number times interval is constant
+func (r *Repository) gapsQuery(tradingSymbol string, vsCurrency string, exchange string, from time.Time, to time.Time) *gorm.DB {
+	interval := r.spec.Interval.Seconds()
+	last := to.Add(-time.Nanosecond).Truncate(r.spec.Interval)
+
+	join := "c.timestamp = e.ts AND c.trading_symbol = @symbol AND c.vs_currency = @vs AND c.exchange = @exchange"
+	if r.spec.Aggregated() {
+		join += " AND c.bar_width = @bar_width"
+	}
+
+	sql := fmt.Sprintf(`WITH missing AS (
+	SELECT e.ts FROM generate_series(CAST(@from AS timestamptz), CAST(@last AS timestamptz), make_interval(secs => @interval)) AS e(ts)
+	LEFT JOIN %s c ON %s
+	WHERE c.id IS NULL
+)
+SELECT MIN(ts) AS start, MAX(ts) + make_interval(secs => @interval) AS "end", COUNT(*) AS missing
+FROM (SELECT ts, ts - ROW_NUMBER() OVER (ORDER BY ts) * make_interval(secs => @interval) AS grp FROM missing) m
+GROUP BY grp
+ORDER BY start`, r.spec.Table, join)
+
+	return r.db.Raw(sql, map[string]interface{}{
+		"symbol":    tradingSymbol,
+		"vs":        vsCurrency,
+		"exchange":  exchange,
+		"bar_width": r.spec.BarWidth,
+		"from":      from,
+		"last":      last,
+		"interval":  interval,
+	})
+}
@@ -0,0 +1,129 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"crypto_project/pkg/models"
+)
+
+// StartFetchRun records the start of a fetch run
+func (db *DB) StartFetchRun(mode string, configHash string) (*models.FetchRun, error) {
+	run := &models.FetchRun{
+		Mode:       mode,
+		ConfigHash: configHash,
+		StartedAt:  time.Now(),
+		Status:     models.FetchStatusRunning,
+	}
+	if err := db.Create(run).Error; err != nil {
+		db.Logger.Errorf("Error recording start of fetch run: %v", err)
+		return nil, err
+	}
+	return run, nil
+}
+
+// FinishFetchRun records the end of a fetch run, errMsg is stored if it is not empty
+func (db *DB) FinishFetchRun(run *models.FetchRun, status string, errMsg string) error {
+	now := time.Now()
+	run.FinishedAt = &now
+	run.Status = status
+	if errMsg != "" {
+		run.Error = &errMsg
+	}
+
+	err := db.Model(run).Select("finished_at", "status", "error").Updates(run).Error
+	if err != nil {
+		db.Logger.Errorf("Error recording end of fetch run %d: %v", run.ID, err)
+	}
+	return err
+}
+
+// StartFetchJob records the start of a job of a fetch run, the ID of job is set on success
+func (db *DB) StartFetchJob(job *models.FetchJob) error {
+	job.StartedAt = time.Now()
+	job.Status = models.FetchStatusRunning
+	if err := db.Create(job).Error; err != nil {
+		db.Logger.Errorf("Error recording start of fetch job: %v", err)
+		return err
+	}
+	return nil
+}
+
+// AddFetchJobProgress adds fetched pages and rows, and the result of saving rows to the counts of a fetch job
+func (db *DB) AddFetchJobProgress(jobID int64, pages int, rowsFetched int, saved UpsertResult) error {
+	err := db.Model(&models.FetchJob{}).Where("id = ?", jobID).Updates(map[string]interface{}{
+		"pages":          gorm.Expr("pages + ?", pages),
+		"rows_fetched":   gorm.Expr("rows_fetched + ?", rowsFetched),
+		"rows_inserted":  gorm.Expr("rows_inserted + ?", saved.Inserted),
+		"rows_updated":   gorm.Expr("rows_updated + ?", saved.Updated),
+		"rows_unchanged": gorm.Expr("rows_unchanged + ?", saved.Unchanged),
+	}).Error
+	if err != nil {
+		db.Logger.Errorf("Error recording progress of fetch job %d: %v", jobID, err)
+	}
+	return err
+}
+
+// FinishFetchJob records the end of a fetch job, errMsg is stored if it is not empty
+func (db *DB) FinishFetchJob(jobID int64, status string, errMsg string) error {
+	updates := map[string]interface{}{
+		"finished_at": time.Now(),
+		"status":      status,
+	}
+	if errMsg != "" {
+		updates["error"] = errMsg
+	}
+
+	err := db.Model(&models.FetchJob{}).Where("id = ?", jobID).Updates(updates).Error
+	if err != nil {
+		db.Logger.Errorf("Error recording end of fetch job %d: %v", jobID, err)
+	}
+	return err
+}
+
+// LatestFetchRun returns the most recently started fetch run, nil if there is none
+func (db *DB) LatestFetchRun() (*models.FetchRun, error) {
+	var run models.FetchRun
+	err := db.Order("started_at desc").First(&run).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		db.Logger.Errorf("Error getting latest fetch run: %v", err)
+		return nil, err
+	}
+	return &run, nil
+}
+
+// UnsuccessfulFetchJobs returns the jobs of a fetch run which did not succeed, including
+// those still running when the run was interrupted
+func (db *DB) UnsuccessfulFetchJobs(runID int64) ([]models.FetchJob, error) {
+	var jobs []models.FetchJob
+	err := db.Where("run_id = ? AND status <> ?", runID, models.FetchStatusSucceeded).
+		Order("id").
+		Find(&jobs).Error
+	if err != nil {
+		db.Logger.Errorf("Error getting unsuccessful jobs of fetch run %d: %v", runID, err)
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// LastSuccessfulFetchJob returns the most recent successful fetch job of a series, nil if there is none
+func (db *DB) LastSuccessfulFetchJob(tradingSymbol string, vsCurrency string, exchange string, timeframe models.Timeframe) (*models.FetchJob, error) {
+	var job models.FetchJob
+	err := db.Where("trading_symbol = ? AND vs_currency = ? AND exchange = ? AND timeframe = ? AND status = ?",
+		tradingSymbol, vsCurrency, exchange, timeframe, models.FetchStatusSucceeded).
+		Order("finished_at desc").
+		First(&job).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		db.Logger.Errorf("Error getting last successful %s fetch job of %s/%s: %v", timeframe, tradingSymbol, vsCurrency, err)
+		return nil, err
+	}
+	return &job, nil
+}
@@ -0,0 +1,338 @@
+package db
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrSchemaBehind is returned when the database has migrations which have not been applied yet
+var ErrSchemaBehind = errors.New("database schema is behind, run migrate up")
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationFileName matches migration files like 0001_create_ohlcv_tables.up.sql
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+const createSchemaMigrationsSQL = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    bigint PRIMARY KEY,
+	name       text NOT NULL,
+	applied_at timestamptz NOT NULL
+)`
+
+// migrationsLockID is the key of the advisory lock held while a migration is applied
+const migrationsLockID = 727001
+
+// Migration is a numbered schema change with the SQL applying and reverting it
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus tells whether a migration has been applied to the database
+type MigrationStatus struct {
+	Migration
+	Applied bool
+	// AppliedAt is zero if the migration has not been applied
+	AppliedAt time.Time
+}
+
+// schemaMigration is a row of schema_migrations, one per applied migration
+type schemaMigration struct {
+	Version   int64 `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Migrations returns the migrations embedded in the binary ordered by version
+func Migrations() ([]Migration, error) {
+	return loadMigrations(migrationFiles, "migrations")
+}
+
+// loadMigrations reads the up and down SQL files of dir, every migration needs both
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name: %s", entry.Name())
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version: %s", entry.Name())
+		}
+		content, err := fs.ReadFile(fsys, dir+"/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// MigrationStatus returns every known migration and whether it has been applied
+func (db *DB) MigrationStatus() ([]MigrationStatus, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		status[i] = MigrationStatus{Migration: m}
+		if a, ok := applied[m.Version]; ok {
+			status[i].Applied = true
+			status[i].AppliedAt = a.AppliedAt
+		}
+	}
+	for version := range applied {
+		if !containsVersion(migrations, version) {
+			db.Logger.Warnf("Migration %d is applied but unknown to this binary, it may be outdated", version)
+		}
+	}
+	return status, nil
+}
+
+// Storage modes of the candle tables. Modes other than StoragePostgres are set up by migrate up
+// after the versioned migrations, they are not recorded in schema_migrations and not reverted
+// by MigrateDown.
+const (
+	StoragePostgres    = "postgres"
+	StorageTimescale   = "timescale"
+	StoragePartitioned = "partitioned"
+	// StorageMixed means the candle tables are not all stored the same way, e.g. after a
+	// setup failed halfway
+	StorageMixed = "mixed"
+)
+
+// StorageMode returns how the minute, hourly and daily candle tables are stored, detected from
+// the catalog of the database since it is not recorded by the migrations. It returns
+// StoragePostgres if the tables do not exist yet.
+func (db *DB) StorageMode() (string, error) {
+	var timescale bool
+	if err := db.Raw("SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'timescaledb')").Row().Scan(&timescale); err != nil {
+		db.Logger.Errorf("Error checking timescaledb extension: %v", err)
+		return "", err
+	}
+
+	var modes []string
+	for _, h := range hypertables {
+		mode := StoragePostgres
+		var kind string
+		err := db.Raw("SELECT COALESCE((SELECT relkind::text FROM pg_class WHERE oid = to_regclass(?)), '')", h.table).Row().Scan(&kind)
+		if err != nil {
+			db.Logger.Errorf("Error checking table %s: %v", h.table, err)
+			return "", err
+		}
+		if kind == "p" {
+			mode = StoragePartitioned
+		}
+
+		if timescale {
+			var hypertable bool
+			err := db.Raw("SELECT EXISTS (SELECT 1 FROM timescaledb_information.hypertables WHERE hypertable_name = ?)", h.table).
+				Row().Scan(&hypertable)
+			if err != nil {
+				db.Logger.Errorf("Error checking hypertable %s: %v", h.table, err)
+				return "", err
+			}
+			if hypertable {
+				mode = StorageTimescale
+			}
+		}
+		modes = append(modes, mode)
+	}
+	return combineStorageModes(modes), nil
+}
+
+// combineStorageModes returns the mode shared by all tables, StorageMixed if they differ
+func combineStorageModes(modes []string) string {
+	if len(modes) == 0 {
+		return StoragePostgres
+	}
+	for _, mode := range modes[1:] {
+		if mode != modes[0] {
+			return StorageMixed
+		}
+	}
+	return modes[0]
+}
+
+// CheckSchema returns ErrSchemaBehind if any migration has not been applied
+func (db *DB) CheckSchema() error {
+	status, err := db.MigrationStatus()
+	if err != nil {
+		return err
+	}
+
+	var pending []int64
+	for _, s := range status {
+		if !s.Applied {
+			pending = append(pending, s.Version)
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w, pending migrations: %v", ErrSchemaBehind, pending)
+	}
+	return nil
+}
+
+// MigrateUp applies all pending migrations in order and returns how many were applied,
+// each migration is applied in its own transaction
+func (db *DB) MigrateUp() (int, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+	if err := db.Exec(createSchemaMigrationsSQL).Error; err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	for _, m := range migrations {
+		done, err := db.applyMigration(m, true)
+		if err != nil {
+			db.Logger.Errorf("Error applying migration %04d_%s: %v", m.Version, m.Name, err)
+			return applied, err
+		}
+		if done {
+			db.Logger.Infof("Applied migration %04d_%s", m.Version, m.Name)
+			applied++
+		}
+	}
+	return applied, nil
+}
+
+// MigrateDown reverts the last steps applied migrations and returns how many were reverted
+func (db *DB) MigrateDown(steps int) (int, error) {
+	status, err := db.MigrationStatus()
+	if err != nil {
+		return 0, err
+	}
+
+	reverted := 0
+	for i := len(status) - 1; i >= 0 && reverted < steps; i-- {
+		if !status[i].Applied {
+			continue
+		}
+		m := status[i].Migration
+		done, err := db.applyMigration(m, false)
+		if err != nil {
+			db.Logger.Errorf("Error reverting migration %04d_%s: %v", m.Version, m.Name, err)
+			return reverted, err
+		}
+		if done {
+			db.Logger.Infof("Reverted migration %04d_%s", m.Version, m.Name)
+			reverted++
+		}
+	}
+	return reverted, nil
+}
+
+// applyMigration runs the up or down SQL of m and records it in schema_migrations in one
+// transaction, it returns false if another process applied or reverted m meanwhile
+func (db *DB) applyMigration(m Migration, up bool) (bool, error) {
+	done := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationsLockID).Error; err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&schemaMigration{}).Where("version = ?", m.Version).Count(&count).Error; err != nil {
+			return err
+		}
+		if (count > 0) == up {
+			return nil
+		}
+
+		if up {
+			if err := tx.Exec(m.Up).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&schemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error; err != nil {
+				return err
+			}
+		} else {
+			if err := tx.Exec(m.Down).Error; err != nil {
+				return err
+			}
+			if err := tx.Delete(&schemaMigration{}, m.Version).Error; err != nil {
+				return err
+			}
+		}
+		done = true
+		return nil
+	})
+	return done, err
+}
+
+// appliedMigrations returns the rows of schema_migrations by version, none if the table does not exist
+func (db *DB) appliedMigrations() (map[int64]schemaMigration, error) {
+	applied := make(map[int64]schemaMigration)
+	if !db.Migrator().HasTable(&schemaMigration{}) {
+		return applied, nil
+	}
+
+	var rows []schemaMigration
+	if err := db.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+func containsVersion(migrations []Migration, version int64) bool {
+	for _, m := range migrations {
+		if m.Version == version {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, m := range migrations {
+		assert.Equal(t, int64(i+1), m.Version, "migrations should be numbered without gaps")
+		assert.NotEmpty(t, m.Up)
+		assert.NotEmpty(t, m.Down)
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	file := func(content string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(content)} }
+
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		want    []Migration
+		wantErr bool
+	}{
+		{
+			name: "sorted by version",
+			files: fstest.MapFS{
+				"m/0002_second.up.sql":   file("up 2"),
+				"m/0002_second.down.sql": file("down 2"),
+				"m/0001_first.up.sql":    file("up 1"),
+				"m/0001_first.down.sql":  file("down 1"),
+			},
+			want: []Migration{
+				{Version: 1, Name: "first", Up: "up 1", Down: "down 1"},
+				{Version: 2, Name: "second", Up: "up 2", Down: "down 2"},
+			},
+		},
+		{
+			name:    "missing down",
+			files:   fstest.MapFS{"m/0001_first.up.sql": file("up 1")},
+			wantErr: true,
+		},
+		{
+			name: "conflicting names",
+			files: fstest.MapFS{
+				"m/0001_first.up.sql":   file("up 1"),
+				"m/0001_other.down.sql": file("down 1"),
+			},
+			wantErr: true,
+		},
+		{
+			name:    "invalid file name",
+			files:   fstest.MapFS{"m/first.sql": file("up 1")},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadMigrations(tt.files, "m")
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCombineStorageModes(t *testing.T) {
+	assert.Equal(t, StoragePostgres, combineStorageModes(nil))
+	assert.Equal(t, StorageTimescale, combineStorageModes([]string{StorageTimescale, StorageTimescale, StorageTimescale}))
+	assert.Equal(t, StorageMixed, combineStorageModes([]string{StoragePartitioned, StoragePartitioned, StoragePostgres}))
+}
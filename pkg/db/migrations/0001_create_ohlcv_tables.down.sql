@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS crypto_ohlcv_daily_go;
+DROP TABLE IF EXISTS crypto_ohlcv_hourly_go;
+DROP TABLE IF EXISTS crypto_ohlcv_minute_go;
@@ -0,0 +1,46 @@
+-- Baseline schema as created by AutoMigrate before versioned migrations, existing
+-- tables are adopted as they are
+CREATE TABLE IF NOT EXISTS crypto_ohlcv_minute_go (
+    id             bigserial PRIMARY KEY,
+    trading_symbol varchar(10) NOT NULL,
+    vs_currency    varchar(10) NOT NULL,
+    timestamp      timestamptz NOT NULL,
+    open           numeric     NOT NULL,
+    high           numeric     NOT NULL,
+    low            numeric     NOT NULL,
+    close          numeric     NOT NULL,
+    volume_from    numeric     NOT NULL,
+    volume_to      numeric     NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_crypto_ohlcv_minute_go_tpair_ts ON crypto_ohlcv_minute_go (trading_symbol, vs_currency, timestamp);
+CREATE INDEX IF NOT EXISTS idx_crypto_ohlcv_minute_go_tpair ON crypto_ohlcv_minute_go (trading_symbol, vs_currency);
+
+CREATE TABLE IF NOT EXISTS crypto_ohlcv_hourly_go (
+    id             bigserial PRIMARY KEY,
+    trading_symbol varchar(10) NOT NULL,
+    vs_currency    varchar(10) NOT NULL,
+    timestamp      timestamptz NOT NULL,
+    open           numeric     NOT NULL,
+    high           numeric     NOT NULL,
+    low            numeric     NOT NULL,
+    close          numeric     NOT NULL,
+    volume_from    numeric     NOT NULL,
+    volume_to      numeric     NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_crypto_ohlcv_hourly_go_tpair_ts ON crypto_ohlcv_hourly_go (trading_symbol, vs_currency, timestamp);
+CREATE INDEX IF NOT EXISTS idx_crypto_ohlcv_hourly_go_tpair ON crypto_ohlcv_hourly_go (trading_symbol, vs_currency);
+
+CREATE TABLE IF NOT EXISTS crypto_ohlcv_daily_go (
+    id             bigserial PRIMARY KEY,
+    trading_symbol varchar(10) NOT NULL,
+    vs_currency    varchar(10) NOT NULL,
+    timestamp      timestamptz NOT NULL,
+    open           numeric     NOT NULL,
+    high           numeric     NOT NULL,
+    low            numeric     NOT NULL,
+    close          numeric     NOT NULL,
+    volume_from    numeric     NOT NULL,
+    volume_to      numeric     NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_crypto_ohlcv_daily_go_tpair_ts ON crypto_ohlcv_daily_go (trading_symbol, vs_currency, timestamp);
+CREATE INDEX IF NOT EXISTS idx_crypto_ohlcv_daily_go_tpair ON crypto_ohlcv_daily_go (trading_symbol, vs_currency);
@@ -0,0 +1,15 @@
+-- Candles of specific exchanges cannot be told apart without the exchange column and are deleted
+DELETE FROM crypto_ohlcv_minute_go WHERE exchange <> 'CCCAGG';
+DROP INDEX IF EXISTS idx_crypto_ohlcv_minute_go_tpair_ts;
+ALTER TABLE crypto_ohlcv_minute_go DROP COLUMN exchange, DROP COLUMN provider;
+CREATE UNIQUE INDEX idx_crypto_ohlcv_minute_go_tpair_ts ON crypto_ohlcv_minute_go (trading_symbol, vs_currency, timestamp);
+
+DELETE FROM crypto_ohlcv_hourly_go WHERE exchange <> 'CCCAGG';
+DROP INDEX IF EXISTS idx_crypto_ohlcv_hourly_go_tpair_ts;
+ALTER TABLE crypto_ohlcv_hourly_go DROP COLUMN exchange, DROP COLUMN provider;
+CREATE UNIQUE INDEX idx_crypto_ohlcv_hourly_go_tpair_ts ON crypto_ohlcv_hourly_go (trading_symbol, vs_currency, timestamp);
+
+DELETE FROM crypto_ohlcv_daily_go WHERE exchange <> 'CCCAGG';
+DROP INDEX IF EXISTS idx_crypto_ohlcv_daily_go_tpair_ts;
+ALTER TABLE crypto_ohlcv_daily_go DROP COLUMN exchange, DROP COLUMN provider;
+CREATE UNIQUE INDEX idx_crypto_ohlcv_daily_go_tpair_ts ON crypto_ohlcv_daily_go (trading_symbol, vs_currency, timestamp);
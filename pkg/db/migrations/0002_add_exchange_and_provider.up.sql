@@ -0,0 +1,18 @@
+-- Candles are keyed by exchange, rows stored before are CryptoCompare's CCCAGG index
+ALTER TABLE crypto_ohlcv_minute_go
+    ADD COLUMN IF NOT EXISTS exchange varchar(32) NOT NULL DEFAULT 'CCCAGG',
+    ADD COLUMN IF NOT EXISTS provider varchar(20) NOT NULL DEFAULT 'cryptocompare';
+DROP INDEX IF EXISTS idx_crypto_ohlcv_minute_go_tpair_ts;
+CREATE UNIQUE INDEX idx_crypto_ohlcv_minute_go_tpair_ts ON crypto_ohlcv_minute_go (trading_symbol, vs_currency, exchange, timestamp);
+
+ALTER TABLE crypto_ohlcv_hourly_go
+    ADD COLUMN IF NOT EXISTS exchange varchar(32) NOT NULL DEFAULT 'CCCAGG',
+    ADD COLUMN IF NOT EXISTS provider varchar(20) NOT NULL DEFAULT 'cryptocompare';
+DROP INDEX IF EXISTS idx_crypto_ohlcv_hourly_go_tpair_ts;
+CREATE UNIQUE INDEX idx_crypto_ohlcv_hourly_go_tpair_ts ON crypto_ohlcv_hourly_go (trading_symbol, vs_currency, exchange, timestamp);
+
+ALTER TABLE crypto_ohlcv_daily_go
+    ADD COLUMN IF NOT EXISTS exchange varchar(32) NOT NULL DEFAULT 'CCCAGG',
+    ADD COLUMN IF NOT EXISTS provider varchar(20) NOT NULL DEFAULT 'cryptocompare';
+DROP INDEX IF EXISTS idx_crypto_ohlcv_daily_go_tpair_ts;
+CREATE UNIQUE INDEX idx_crypto_ohlcv_daily_go_tpair_ts ON crypto_ohlcv_daily_go (trading_symbol, vs_currency, exchange, timestamp);
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS crypto_ohlcv_aggregated_go (
+    id             bigserial PRIMARY KEY,
+    trading_symbol varchar(10) NOT NULL,
+    vs_currency    varchar(10) NOT NULL,
+    exchange       varchar(32) NOT NULL DEFAULT 'CCCAGG',
+    provider       varchar(20) NOT NULL DEFAULT 'cryptocompare',
+    bar_width      varchar(10) NOT NULL,
+    timestamp      timestamptz NOT NULL,
+    open           numeric     NOT NULL,
+    high           numeric     NOT NULL,
+    low            numeric     NOT NULL,
+    close          numeric     NOT NULL,
+    volume_from    numeric     NOT NULL,
+    volume_to      numeric     NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_crypto_ohlcv_aggregated_go_tpair_width_ts
+    ON crypto_ohlcv_aggregated_go (trading_symbol, vs_currency, exchange, bar_width, timestamp);
+CREATE INDEX IF NOT EXISTS idx_crypto_ohlcv_aggregated_go_tpair_width
+    ON crypto_ohlcv_aggregated_go (trading_symbol, vs_currency, bar_width);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS fetch_jobs;
+DROP TABLE IF EXISTS fetch_runs;
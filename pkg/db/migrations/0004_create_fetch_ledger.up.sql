@@ -0,0 +1,33 @@
+CREATE TABLE fetch_runs (
+    id          bigserial PRIMARY KEY,
+    mode        varchar(20) NOT NULL,
+    config_hash varchar(64) NOT NULL,
+    started_at  timestamptz NOT NULL,
+    finished_at timestamptz,
+    status      varchar(20) NOT NULL,
+    error       text
+);
+
+CREATE TABLE fetch_jobs (
+    id             bigserial PRIMARY KEY,
+    run_id         bigint      NOT NULL REFERENCES fetch_runs (id) ON DELETE CASCADE,
+    trading_symbol varchar(10) NOT NULL,
+    vs_currency    varchar(10) NOT NULL,
+    exchange       varchar(32) NOT NULL,
+    provider       varchar(20) NOT NULL,
+    timeframe      varchar(10) NOT NULL,
+    "limit"        integer     NOT NULL,
+    -- since is the time incremental jobs fetched bars from, retried jobs fetch from it again
+    since          timestamptz,
+    started_at     timestamptz NOT NULL,
+    finished_at    timestamptz,
+    pages          integer     NOT NULL DEFAULT 0,
+    rows_fetched   integer     NOT NULL DEFAULT 0,
+    rows_inserted  integer     NOT NULL DEFAULT 0,
+    rows_updated   integer     NOT NULL DEFAULT 0,
+    rows_unchanged integer     NOT NULL DEFAULT 0,
+    status         varchar(20) NOT NULL,
+    error          text
+);
+CREATE INDEX idx_fetch_jobs_run ON fetch_jobs (run_id);
+CREATE INDEX idx_fetch_jobs_series ON fetch_jobs (trading_symbol, vs_currency, exchange, timeframe, status, finished_at);
@@ -0,0 +1,11 @@
+DROP TRIGGER trg_crypto_ohlcv_aggregated_go_revision ON crypto_ohlcv_aggregated_go;
+DROP TRIGGER trg_crypto_ohlcv_daily_go_revision ON crypto_ohlcv_daily_go;
+DROP TRIGGER trg_crypto_ohlcv_hourly_go_revision ON crypto_ohlcv_hourly_go;
+DROP TRIGGER trg_crypto_ohlcv_minute_go_revision ON crypto_ohlcv_minute_go;
+DROP FUNCTION record_ohlcv_revision();
+DROP TABLE crypto_ohlcv_revisions;
+
+ALTER TABLE crypto_ohlcv_aggregated_go DROP COLUMN inserted_at;
+ALTER TABLE crypto_ohlcv_daily_go DROP COLUMN inserted_at;
+ALTER TABLE crypto_ohlcv_hourly_go DROP COLUMN inserted_at;
+ALTER TABLE crypto_ohlcv_minute_go DROP COLUMN inserted_at;
@@ -0,0 +1,86 @@
+-- Candles restated upstream keep their previous values in crypto_ohlcv_revisions, so a
+-- series can be read as it was stored at a past time. inserted_at of candles stored before
+-- is unknown, they are treated as always stored.
+ALTER TABLE crypto_ohlcv_minute_go ADD COLUMN inserted_at timestamptz NOT NULL DEFAULT '-infinity';
+ALTER TABLE crypto_ohlcv_minute_go ALTER COLUMN inserted_at SET DEFAULT now();
+ALTER TABLE crypto_ohlcv_hourly_go ADD COLUMN inserted_at timestamptz NOT NULL DEFAULT '-infinity';
+ALTER TABLE crypto_ohlcv_hourly_go ALTER COLUMN inserted_at SET DEFAULT now();
+ALTER TABLE crypto_ohlcv_daily_go ADD COLUMN inserted_at timestamptz NOT NULL DEFAULT '-infinity';
+ALTER TABLE crypto_ohlcv_daily_go ALTER COLUMN inserted_at SET DEFAULT now();
+ALTER TABLE crypto_ohlcv_aggregated_go ADD COLUMN inserted_at timestamptz NOT NULL DEFAULT '-infinity';
+ALTER TABLE crypto_ohlcv_aggregated_go ALTER COLUMN inserted_at SET DEFAULT now();
+
+CREATE TABLE crypto_ohlcv_revisions (
+    id              bigserial PRIMARY KEY,
+    table_name      varchar(63) NOT NULL,
+    -- bar_width is empty for the tables of the built-in timeframes
+    bar_width       varchar(10) NOT NULL DEFAULT '',
+    trading_symbol  varchar(10) NOT NULL,
+    vs_currency     varchar(10) NOT NULL,
+    exchange        varchar(32) NOT NULL,
+    timestamp       timestamptz NOT NULL,
+    old_provider    varchar(20) NOT NULL,
+    old_open        numeric     NOT NULL,
+    old_high        numeric     NOT NULL,
+    old_low         numeric     NOT NULL,
+    old_close       numeric     NOT NULL,
+    old_volume_from numeric     NOT NULL,
+    old_volume_to   numeric     NOT NULL,
+    new_provider    varchar(20) NOT NULL,
+    new_open        numeric     NOT NULL,
+    new_high        numeric     NOT NULL,
+    new_low         numeric     NOT NULL,
+    new_close       numeric     NOT NULL,
+    new_volume_from numeric     NOT NULL,
+    new_volume_to   numeric     NOT NULL,
+    run_id          bigint      REFERENCES fetch_runs (id) ON DELETE SET NULL,
+    revised_at      timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX idx_crypto_ohlcv_revisions_series
+    ON crypto_ohlcv_revisions (table_name, trading_symbol, vs_currency, exchange, bar_width, timestamp, revised_at);
+CREATE INDEX idx_crypto_ohlcv_revisions_run ON crypto_ohlcv_revisions (run_id);
+
+-- The fetch run saving the candles is read from the crypto_project.fetch_run_id setting
+-- of the transaction, if it is set
+CREATE FUNCTION record_ohlcv_revision() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO crypto_ohlcv_revisions (
+        table_name, bar_width, trading_symbol, vs_currency, exchange, timestamp,
+        old_provider, old_open, old_high, old_low, old_close, old_volume_from, old_volume_to,
+        new_provider, new_open, new_high, new_low, new_close, new_volume_from, new_volume_to,
+        run_id
+    ) VALUES (
+        TG_TABLE_NAME, COALESCE(to_jsonb(NEW) ->> 'bar_width', ''),
+        NEW.trading_symbol, NEW.vs_currency, NEW.exchange, NEW.timestamp,
+        OLD.provider, OLD.open, OLD.high, OLD.low, OLD.close, OLD.volume_from, OLD.volume_to,
+        NEW.provider, NEW.open, NEW.high, NEW.low, NEW.close, NEW.volume_from, NEW.volume_to,
+        CAST(NULLIF(current_setting('crypto_project.fetch_run_id', true), '') AS bigint)
+    );
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_crypto_ohlcv_minute_go_revision AFTER UPDATE ON crypto_ohlcv_minute_go
+    FOR EACH ROW WHEN (OLD.open IS DISTINCT FROM NEW.open OR OLD.high IS DISTINCT FROM NEW.high
+        OR OLD.low IS DISTINCT FROM NEW.low OR OLD.close IS DISTINCT FROM NEW.close
+        OR OLD.volume_from IS DISTINCT FROM NEW.volume_from OR OLD.volume_to IS DISTINCT FROM NEW.volume_to
+        OR OLD.provider IS DISTINCT FROM NEW.provider)
+    EXECUTE FUNCTION record_ohlcv_revision();
+CREATE TRIGGER trg_crypto_ohlcv_hourly_go_revision AFTER UPDATE ON crypto_ohlcv_hourly_go
+    FOR EACH ROW WHEN (OLD.open IS DISTINCT FROM NEW.open OR OLD.high IS DISTINCT FROM NEW.high
+        OR OLD.low IS DISTINCT FROM NEW.low OR OLD.close IS DISTINCT FROM NEW.close
+        OR OLD.volume_from IS DISTINCT FROM NEW.volume_from OR OLD.volume_to IS DISTINCT FROM NEW.volume_to
+        OR OLD.provider IS DISTINCT FROM NEW.provider)
+    EXECUTE FUNCTION record_ohlcv_revision();
+CREATE TRIGGER trg_crypto_ohlcv_daily_go_revision AFTER UPDATE ON crypto_ohlcv_daily_go
+    FOR EACH ROW WHEN (OLD.open IS DISTINCT FROM NEW.open OR OLD.high IS DISTINCT FROM NEW.high
+        OR OLD.low IS DISTINCT FROM NEW.low OR OLD.close IS DISTINCT FROM NEW.close
+        OR OLD.volume_from IS DISTINCT FROM NEW.volume_from OR OLD.volume_to IS DISTINCT FROM NEW.volume_to
+        OR OLD.provider IS DISTINCT FROM NEW.provider)
+    EXECUTE FUNCTION record_ohlcv_revision();
+CREATE TRIGGER trg_crypto_ohlcv_aggregated_go_revision AFTER UPDATE ON crypto_ohlcv_aggregated_go
+    FOR EACH ROW WHEN (OLD.open IS DISTINCT FROM NEW.open OR OLD.high IS DISTINCT FROM NEW.high
+        OR OLD.low IS DISTINCT FROM NEW.low OR OLD.close IS DISTINCT FROM NEW.close
+        OR OLD.volume_from IS DISTINCT FROM NEW.volume_from OR OLD.volume_to IS DISTINCT FROM NEW.volume_to
+        OR OLD.provider IS DISTINCT FROM NEW.provider)
+    EXECUTE FUNCTION record_ohlcv_revision();
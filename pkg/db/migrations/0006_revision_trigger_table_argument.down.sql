@@ -0,0 +1,17 @@
+CREATE OR REPLACE FUNCTION record_ohlcv_revision() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO crypto_ohlcv_revisions (
+        table_name, bar_width, trading_symbol, vs_currency, exchange, timestamp,
+        old_provider, old_open, old_high, old_low, old_close, old_volume_from, old_volume_to,
+        new_provider, new_open, new_high, new_low, new_close, new_volume_from, new_volume_to,
+        run_id
+    ) VALUES (
+        TG_TABLE_NAME, COALESCE(to_jsonb(NEW) ->> 'bar_width', ''),
+        NEW.trading_symbol, NEW.vs_currency, NEW.exchange, NEW.timestamp,
+        OLD.provider, OLD.open, OLD.high, OLD.low, OLD.close, OLD.volume_from, OLD.volume_to,
+        NEW.provider, NEW.open, NEW.high, NEW.low, NEW.close, NEW.volume_from, NEW.volume_to,
+        CAST(NULLIF(current_setting('crypto_project.fetch_run_id', true), '') AS bigint)
+    );
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
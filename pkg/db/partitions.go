@@ -0,0 +1,384 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"crypto_project/pkg/models"
+)
+
+// DefaultMonthsAhead is how many monthly partitions following the current month are created by default
+const DefaultMonthsAhead = 3
+
+// PartitionedTimeframes are the timeframes whose candle tables are partitioned by month when
+// storage is "partitioned"
+var PartitionedTimeframes = []models.Timeframe{models.TimeframeMinute, models.TimeframeHourly, models.TimeframeDaily}
+
+// MonthsAhead returns monthsAhead, or DefaultMonthsAhead if it is not positive
+func MonthsAhead(monthsAhead int) int {
+	if monthsAhead <= 0 {
+		return DefaultMonthsAhead
+	}
+	return monthsAhead
+}
+
+// IsPartitioned reports whether the candle table of tf is partitioned when storage is "partitioned"
+func IsPartitioned(tf models.Timeframe) bool {
+	for _, t := range PartitionedTimeframes {
+		if t == tf {
+			return true
+		}
+	}
+	return false
+}
+
+// partitionBoundLayout formats partition bounds as UTC timestamps, independent of the session time zone
+const partitionBoundLayout = "2006-01-02 15:04:05-07"
+
+// Partition is a monthly partition of a candle table, holding the candles of [Month, next month)
+type Partition struct {
+	Name  string
+	Month time.Time
+}
+
+// SetupPartitioning converts the minute, hourly and daily candle tables to tables partitioned
+// by month of timestamp, with partitions up to monthsAhead months after the current one and a
+// default partition for candles of months without a partition. It can be run again, tables
+// which are partitioned already are left as they are.
+//
+// The rows of a table are copied into the partitioned table in one transaction, which locks
+// the table meanwhile.
+func (db *DB) SetupPartitioning(monthsAhead int, now time.Time) error {
+	for _, tf := range PartitionedTimeframes {
+		spec, err := models.LookupTimeframe(tf)
+		if err != nil {
+			return err
+		}
+		table := spec.Table
+
+		var kind string
+		if err := db.Raw("SELECT relkind FROM pg_class WHERE oid = CAST(? AS regclass)", table).Row().Scan(&kind); err != nil {
+			db.Logger.Errorf("Error checking table %s: %v", table, err)
+			return err
+		}
+		if kind == "p" {
+			db.Logger.Debugf("%s is partitioned already", table)
+			continue
+		}
+
+		db.Logger.Infof("Converting %s to a partitioned table", table)
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			return partitionTable(tx, table, monthsAhead, now)
+		}); err != nil {
+			db.Logger.Errorf("Error converting %s to a partitioned table: %v", table, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// partitionTable replaces table by a partitioned table with the same columns and rows. The old
+// table is dropped before the indexes are created, since they keep their names.
+func partitionTable(tx *gorm.DB, table string, monthsAhead int, now time.Time) error {
+	old := table + "_unpartitioned"
+	stmts := []string{
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", table, old),
+		fmt.Sprintf("CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS) PARTITION BY RANGE (timestamp)", table, old),
+		fmt.Sprintf("ALTER SEQUENCE %s_id_seq OWNED BY %s.id", table, table),
+		fmt.Sprintf("CREATE TABLE %s_default PARTITION OF %s DEFAULT", table, table),
+	}
+	if err := execAll(tx, stmts); err != nil {
+		return err
+	}
+
+	var oldest sql.NullTime
+	if err := tx.Raw(fmt.Sprintf("SELECT MIN(timestamp) FROM %s", old)).Row().Scan(&oldest); err != nil {
+		return err
+	}
+	from := monthStart(now)
+	if oldest.Valid && oldest.Time.Before(from) {
+		from = monthStart(oldest.Time)
+	}
+
+	stmts = nil
+	for _, month := range months(from, monthStart(now).AddDate(0, monthsAhead, 0)) {
+		stmts = append(stmts, createPartitionSQL(table, month))
+	}
+	stmts = append(stmts,
+		fmt.Sprintf("INSERT INTO %s SELECT * FROM %s", table, old),
+		fmt.Sprintf("DROP TABLE %s", old),
+		fmt.Sprintf("ALTER TABLE %s ADD PRIMARY KEY (id, timestamp)", table),
+		fmt.Sprintf("CREATE UNIQUE INDEX idx_%s_tpair_ts ON %s (trading_symbol, vs_currency, exchange, timestamp)", table, table),
+		fmt.Sprintf("CREATE INDEX idx_%s_tpair ON %s (trading_symbol, vs_currency)", table, table),
+		revisionTriggerSQL(table),
+	)
+	return execAll(tx, stmts)
+}
+
+// Partitions returns the monthly partitions attached to table ordered by month, the default
+// partition is not included
+func (db *DB) Partitions(table string) ([]Partition, error) {
+	var names []string
+	err := db.Raw(`SELECT c.relname FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid
+WHERE i.inhparent = CAST(? AS regclass)`, table).Scan(&names).Error
+	if err != nil {
+		db.Logger.Errorf("Error listing partitions of %s: %v", table, err)
+		return nil, err
+	}
+
+	var partitions []Partition
+	for _, name := range names {
+		if p, ok := parsePartition(table, name); ok {
+			partitions = append(partitions, p)
+		}
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].Month.Before(partitions[j].Month) })
+	return partitions, nil
+}
+
+// EnsurePartitions creates the partitions of table up to monthsAhead months after the current
+// one, and the partitions of months whose candles are in the default partition, moving the
+// candles into them. It returns the names of the partitions created.
+func (db *DB) EnsurePartitions(table string, monthsAhead int, now time.Time) ([]string, error) {
+	partitions, err := db.Partitions(table)
+	if err != nil {
+		return nil, err
+	}
+
+	var stray []time.Time
+	err = db.Raw(fmt.Sprintf(
+		"SELECT DISTINCT date_trunc('month', timestamp AT TIME ZONE 'UTC') FROM %s_default", table)).
+		Scan(&stray).Error
+	if err != nil {
+		db.Logger.Errorf("Error listing months in the default partition of %s: %v", table, err)
+		return nil, err
+	}
+
+	var created []string
+	for _, month := range stray {
+		month = monthStart(month)
+		db.Logger.Infof("Moving candles of %s from the default partition of %s", month.Format("2006-01"), table)
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			return execAll(tx, attachDefaultRowsSQL(table, month))
+		}); err != nil {
+			db.Logger.Errorf("Error creating partition of %s for %s: %v", table, month.Format("2006-01"), err)
+			return created, err
+		}
+		created = append(created, partitionName(table, month))
+		partitions = append(partitions, Partition{Name: partitionName(table, month), Month: month})
+	}
+
+	for _, month := range missingMonths(partitions, monthStart(now), monthsAhead) {
+		if err := db.Exec(createPartitionSQL(table, month)).Error; err != nil {
+			db.Logger.Errorf("Error creating partition of %s for %s: %v", table, month.Format("2006-01"), err)
+			return created, err
+		}
+		created = append(created, partitionName(table, month))
+	}
+	return created, nil
+}
+
+// ExpirePartitions detaches the partitions of table older than the keepMonths months before
+// the current one and returns their names. Detached partitions are kept as tables of their own
+// until DropPartition archives their candles.
+func (db *DB) ExpirePartitions(table string, keepMonths int, now time.Time) ([]string, error) {
+	partitions, err := db.Partitions(table)
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []string
+	for _, p := range expiredPartitions(partitions, monthStart(now).AddDate(0, -keepMonths, 0)) {
+		if err := db.Exec(fmt.Sprintf("ALTER TABLE %s DETACH PARTITION %s", table, p.Name)).Error; err != nil {
+			db.Logger.Errorf("Error expiring partition %s: %v", p.Name, err)
+			return expired, err
+		}
+		expired = append(expired, p.Name)
+	}
+	return expired, nil
+}
+
+// DetachedPartitions returns the monthly partitions of table which are not attached to it any
+// more, ordered by month
+func (db *DB) DetachedPartitions(table string) ([]Partition, error) {
+	var names []string
+	err := db.Raw(`SELECT c.relname FROM pg_class c
+WHERE c.relkind = 'r' AND c.relnamespace = CAST(current_schema() AS regnamespace) AND starts_with(c.relname, ?)
+AND NOT EXISTS (SELECT 1 FROM pg_inherits i WHERE i.inhrelid = c.oid)`, table+"_p").Scan(&names).Error
+	if err != nil {
+		db.Logger.Errorf("Error listing detached partitions of %s: %v", table, err)
+		return nil, err
+	}
+
+	var partitions []Partition
+	for _, name := range names {
+		if p, ok := parsePartition(table, name); ok {
+			partitions = append(partitions, p)
+		}
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].Month.Before(partitions[j].Month) })
+	return partitions, nil
+}
+
+// DropPartition drops the detached partition p once its candles are archived and returns how
+// many candles were archived. archive is given the candles of every series of the partition in
+// batches of up to batchSize ordered by timestamp, the partition is kept if it fails. An empty
+// partition, e.g. one whose candles were pruned already, is dropped right away.
+func (db *DB) DropPartition(p Partition, batchSize int, archive func(Series, []models.CryptoOHLCV) error) (int, error) {
+	var attached bool
+	err := db.Raw("SELECT EXISTS (SELECT 1 FROM pg_inherits WHERE inhrelid = CAST(? AS regclass))", p.Name).Row().Scan(&attached)
+	if err != nil {
+		db.Logger.Errorf("Error checking partition %s: %v", p.Name, err)
+		return 0, err
+	}
+	if attached {
+		return 0, fmt.Errorf("partition %s is attached", p.Name)
+	}
+
+	var series []Series
+	err = db.Raw(fmt.Sprintf(`SELECT trading_symbol, vs_currency, exchange, MIN(timestamp) AS first, MAX(timestamp) AS last
+FROM %s GROUP BY trading_symbol, vs_currency, exchange ORDER BY trading_symbol, vs_currency, exchange`, p.Name)).
+		Scan(&series).Error
+	if err != nil {
+		db.Logger.Errorf("Error listing series of partition %s: %v", p.Name, err)
+		return 0, err
+	}
+
+	archived := 0
+	for _, s := range series {
+		n, err := db.archivePartitionSeries(p, s, batchSize, archive)
+		archived += n
+		if err != nil {
+			db.Logger.Errorf("Error archiving %s/%s of partition %s: %v", s.TradingSymbol, s.VsCurrency, p.Name, err)
+			return archived, err
+		}
+	}
+
+	if err := db.Exec(fmt.Sprintf("DROP TABLE %s", p.Name)).Error; err != nil {
+		db.Logger.Errorf("Error dropping partition %s: %v", p.Name, err)
+		return archived, err
+	}
+	return archived, nil
+}
+
+// archivePartitionSeries gives the candles of series s in partition p to archive in batches of
+// up to batchSize, paging by timestamp as it is unique within a series
+func (db *DB) archivePartitionSeries(p Partition, s Series, batchSize int, archive func(Series, []models.CryptoOHLCV) error) (int, error) {
+	archived := 0
+	var last time.Time
+	for {
+		query := db.Table(p.Name).
+			Where("trading_symbol = ? AND vs_currency = ? AND exchange = ?", s.TradingSymbol, s.VsCurrency, s.Exchange)
+		if archived > 0 {
+			query = query.Where("timestamp > ?", last)
+		}
+
+		var data []models.CryptoOHLCV
+		if err := query.Order("timestamp").Limit(batchSize).Find(&data).Error; err != nil || len(data) == 0 {
+			return archived, err
+		}
+		if err := archive(s, data); err != nil {
+			return archived, err
+		}
+		archived += len(data)
+		last = data[len(data)-1].Timestamp
+	}
+}
+
+// execAll runs statements in order, stopping at the first failing one
+func execAll(tx *gorm.DB, stmts []string) error {
+	for _, stmt := range stmts {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attachDefaultRowsSQL returns the statements moving the candles of month from the default
+// partition of table into a new partition, which must not overlap the default partition when attached
+func attachDefaultRowsSQL(table string, month time.Time) []string {
+	name := partitionName(table, month)
+	from, to := partitionBounds(month)
+	return []string{
+		fmt.Sprintf("CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS)", name, table),
+		fmt.Sprintf("WITH moved AS (DELETE FROM %s_default WHERE timestamp >= '%s' AND timestamp < '%s' RETURNING *) "+
+			"INSERT INTO %s SELECT * FROM moved", table, from, to, name),
+		fmt.Sprintf("ALTER TABLE %s ATTACH PARTITION %s FOR VALUES FROM ('%s') TO ('%s')", table, name, from, to),
+	}
+}
+
+func createPartitionSQL(table string, month time.Time) string {
+	from, to := partitionBounds(month)
+	return fmt.Sprintf("CREATE TABLE %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')",
+		partitionName(table, month), table, from, to)
+}
+
+// partitionName returns the name of the partition of table for month, e.g. crypto_ohlcv_minute_go_p202401
+func partitionName(table string, month time.Time) string {
+	return fmt.Sprintf("%s_p%s", table, month.Format("200601"))
+}
+
+// parsePartition returns the partition of table named name, ok is false if it is not a monthly partition
+func parsePartition(table string, name string) (Partition, bool) {
+	suffix := strings.TrimPrefix(name, table+"_p")
+	if suffix == name {
+		return Partition{}, false
+	}
+	month, err := time.Parse("200601", suffix)
+	if err != nil {
+		return Partition{}, false
+	}
+	return Partition{Name: name, Month: month}, true
+}
+
+func partitionBounds(month time.Time) (string, string) {
+	return month.Format(partitionBoundLayout), month.AddDate(0, 1, 0).Format(partitionBoundLayout)
+}
+
+// missingMonths returns the months from current up to monthsAhead months later without a partition
+func missingMonths(partitions []Partition, current time.Time, monthsAhead int) []time.Time {
+	existing := make(map[time.Time]bool, len(partitions))
+	for _, p := range partitions {
+		existing[p.Month] = true
+	}
+
+	var missing []time.Time
+	for _, month := range months(current, current.AddDate(0, monthsAhead, 0)) {
+		if !existing[month] {
+			missing = append(missing, month)
+		}
+	}
+	return missing
+}
+
+// expiredPartitions returns the partitions of months before cutoff
+func expiredPartitions(partitions []Partition, cutoff time.Time) []Partition {
+	var expired []Partition
+	for _, p := range partitions {
+		if p.Month.Before(cutoff) {
+			expired = append(expired, p)
+		}
+	}
+	return expired
+}
+
+// months returns the first instants of the months from from to to, both included
+func months(from time.Time, to time.Time) []time.Time {
+	var result []time.Time
+	for month := from; !month.After(to); month = month.AddDate(0, 1, 0) {
+		result = append(result, month)
+	}
+	return result
+}
+
+// monthStart returns the first instant of the month of t in UTC
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"crypto_project/pkg/models"
+)
+
+func month(year int, m time.Month) time.Time {
+	return time.Date(year, m, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func TestMonthStart(t *testing.T) {
+	taipei := time.FixedZone("Asia/Taipei", 8*60*60)
+
+	tests := []struct {
+		name string
+		t    time.Time
+		want time.Time
+	}{
+		{name: "middle of month", t: time.Date(2024, 2, 17, 13, 45, 0, 0, time.UTC), want: month(2024, 2)},
+		{name: "first instant", t: month(2024, 3), want: month(2024, 3)},
+		// still January in UTC
+		{name: "other time zone", t: time.Date(2024, 2, 1, 7, 0, 0, 0, taipei), want: month(2024, 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, monthStart(tt.t))
+		})
+	}
+}
+
+func TestMonthsAhead(t *testing.T) {
+	assert.Equal(t, DefaultMonthsAhead, MonthsAhead(0))
+	assert.Equal(t, DefaultMonthsAhead, MonthsAhead(-1))
+	assert.Equal(t, 6, MonthsAhead(6))
+}
+
+func TestIsPartitioned(t *testing.T) {
+	assert.True(t, IsPartitioned(models.TimeframeMinute))
+	assert.True(t, IsPartitioned(models.TimeframeDaily))
+	assert.False(t, IsPartitioned(models.Timeframe("15m")))
+}
+
+func TestPartitionName(t *testing.T) {
+	name := partitionName("crypto_ohlcv_minute_go", month(2024, 1))
+	assert.Equal(t, "crypto_ohlcv_minute_go_p202401", name)
+
+	p, ok := parsePartition("crypto_ohlcv_minute_go", name)
+	assert.True(t, ok)
+	assert.Equal(t, Partition{Name: name, Month: month(2024, 1)}, p)
+
+	for _, other := range []string{"crypto_ohlcv_minute_go_default", "crypto_ohlcv_hourly_go_p202401", "crypto_ohlcv_minute_go_pnext"} {
+		_, ok := parsePartition("crypto_ohlcv_minute_go", other)
+		assert.False(t, ok, other)
+	}
+}
+
+func TestPartitionSQL(t *testing.T) {
+	assert.Equal(t,
+		"CREATE TABLE crypto_ohlcv_hourly_go_p202412 PARTITION OF crypto_ohlcv_hourly_go "+
+			"FOR VALUES FROM ('2024-12-01 00:00:00+00') TO ('2025-01-01 00:00:00+00')",
+		createPartitionSQL("crypto_ohlcv_hourly_go", month(2024, 12)))
+
+	assert.Equal(t, []string{
+		"CREATE TABLE crypto_ohlcv_minute_go_p202301 (LIKE crypto_ohlcv_minute_go INCLUDING DEFAULTS)",
+		"WITH moved AS (DELETE FROM crypto_ohlcv_minute_go_default " +
+			"WHERE timestamp >= '2023-01-01 00:00:00+00' AND timestamp < '2023-02-01 00:00:00+00' RETURNING *) " +
+			"INSERT INTO crypto_ohlcv_minute_go_p202301 SELECT * FROM moved",
+		"ALTER TABLE crypto_ohlcv_minute_go ATTACH PARTITION crypto_ohlcv_minute_go_p202301 " +
+			"FOR VALUES FROM ('2023-01-01 00:00:00+00') TO ('2023-02-01 00:00:00+00')",
+	}, attachDefaultRowsSQL("crypto_ohlcv_minute_go", month(2023, 1)))
+}
+
+func TestMissingMonths(t *testing.T) {
+	partitions := []Partition{
+		{Name: "t_p202411", Month: month(2024, 11)},
+		{Name: "t_p202412", Month: month(2024, 12)},
+		{Name: "t_p202502", Month: month(2025, 2)},
+	}
+
+	assert.Equal(t, []time.Time{month(2025, 1), month(2025, 3)}, missingMonths(partitions, month(2024, 12), 3))
+	assert.Empty(t, missingMonths(partitions, month(2024, 11), 1))
+}
+
+func TestExpiredPartitions(t *testing.T) {
+	partitions := []Partition{
+		{Name: "t_p202401", Month: month(2024, 1)},
+		{Name: "t_p202402", Month: month(2024, 2)},
+		{Name: "t_p202403", Month: month(2024, 3)},
+	}
+
+	assert.Equal(t, partitions[:2], expiredPartitions(partitions, month(2024, 3)))
+	assert.Empty(t, expiredPartitions(partitions, month(2024, 1)))
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"crypto_project/pkg/models"
+)
+
+// newPostgresDB connects to the PostgreSQL database of TEST_POSTGRES_DSN and migrates it,
+// the test is skipped if it is not set
+func newPostgresDB(t *testing.T, opts ...Option) *DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+	logger := logrus.New()
+	logger.Out = io.Discard
+
+	db, err := NewDB(dsn, logger, append(opts, WithoutSchemaCheck())...)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	_, err = db.MigrateUp()
+	require.NoError(t, err)
+	return db
+}
+
+func TestPostgresUpsertDuplicates(t *testing.T) {
+	db := newPostgresDB(t, WithBatchSize(3))
+	repo, err := db.Repository(models.TimeframeHourly)
+	require.NoError(t, err)
+
+	candle := func(ts time.Time, close string) models.CryptoOHLCV {
+		c := sqliteCandle(ts, close)
+		c.TradingSymbol = "DUPTEST"
+		return c
+	}
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM crypto_ohlcv_revisions WHERE trading_symbol = ?", "DUPTEST")
+		db.Exec("DELETE FROM crypto_ohlcv_hourly_go WHERE trading_symbol = ?", "DUPTEST")
+	})
+
+	start := time.Unix(1700000000, 0).UTC().Truncate(time.Hour)
+	// a key twice in one batch, which ON CONFLICT DO UPDATE cannot update twice
+	result, err := repo.Upsert([]models.CryptoOHLCV{
+		candle(start, "37050.1"),
+		candle(start.Add(time.Hour), "37060.2"),
+		candle(start, "37051"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, UpsertResult{Inserted: 2, Unchanged: 1}, result)
+
+	result, err = repo.BulkUpsert(context.Background(), []models.CryptoOHLCV{
+		candle(start.Add(time.Hour), "37061"),
+		candle(start.Add(time.Hour), "37062"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, UpsertResult{Updated: 1, Unchanged: 1}, result)
+
+	stored, err := repo.Get(10, "DUPTEST", "USD", "CCCAGG")
+	require.NoError(t, err)
+	require.Len(t, stored, 2)
+	closes := map[int64]string{}
+	for _, d := range stored {
+		closes[d.Timestamp.Unix()] = d.Close.String()
+	}
+	assert.Equal(t, map[int64]string{start.Unix(): "37051", start.Add(time.Hour).Unix(): "37062"}, closes)
+}
+
+func TestPostgresDropPartition(t *testing.T) {
+	db := newPostgresDB(t)
+	const table = "crypto_ohlcv_hourly_go"
+	p := Partition{Name: partitionName(table, month(1990, 1)), Month: month(1990, 1)}
+
+	// a partition detached by ExpirePartitions is a table of its own like this one
+	require.NoError(t, db.Exec(fmt.Sprintf("CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS)", p.Name, table)).Error)
+	t.Cleanup(func() { db.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", p.Name)) })
+
+	start := month(1990, 1)
+	for i, symbol := range []string{"BTC", "BTC", "BTC", "ETH"} {
+		c := sqliteCandle(start.Add(time.Duration(i)*time.Hour), "1")
+		c.TradingSymbol = symbol
+		require.NoError(t, db.Table(p.Name).Create(&c).Error)
+	}
+
+	detached, err := db.DetachedPartitions(table)
+	require.NoError(t, err)
+	assert.Contains(t, detached, p)
+
+	batches := map[string][]int{}
+	archived, err := db.DropPartition(p, 2, func(s Series, data []models.CryptoOHLCV) error {
+		batches[s.TradingSymbol] = append(batches[s.TradingSymbol], len(data))
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 4, archived)
+	assert.Equal(t, map[string][]int{"BTC": {2, 1}, "ETH": {1}}, batches)
+
+	detached, err = db.DetachedPartitions(table)
+	require.NoError(t, err)
+	assert.NotContains(t, detached, p)
+}
+
+func TestPostgresDropPartitionArchiveFails(t *testing.T) {
+	db := newPostgresDB(t)
+	const table = "crypto_ohlcv_hourly_go"
+	p := Partition{Name: partitionName(table, month(1990, 2)), Month: month(1990, 2)}
+
+	require.NoError(t, db.Exec(fmt.Sprintf("CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS)", p.Name, table)).Error)
+	t.Cleanup(func() { db.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", p.Name)) })
+	c := sqliteCandle(month(1990, 2), "1")
+	require.NoError(t, db.Table(p.Name).Create(&c).Error)
+
+	_, err := db.DropPartition(p, 10, func(Series, []models.CryptoOHLCV) error { return errors.New("disk full") })
+	assert.Error(t, err)
+
+	detached, err := db.DetachedPartitions(table)
+	require.NoError(t, err)
+	assert.Contains(t, detached, p, "the partition is kept if its candles could not be archived")
+}
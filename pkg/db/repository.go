@@ -0,0 +1,110 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"crypto_project/pkg/models"
+)
+
+// Repository reads and writes the candles of one timeframe in PostgreSQL
+type Repository struct {
+	candleTable
+	// runID is the fetch run recorded with the revisions caused by upserts, 0 if there is none
+	runID int64
+}
+
+// Repository returns the repository of a timeframe registered with models.RegisterTimeframe
+func (db *DB) Repository(timeframe models.Timeframe) (*Repository, error) {
+	spec, err := models.LookupTimeframe(timeframe)
+	if err != nil {
+		return nil, err
+	}
+	return &Repository{candleTable: candleTable{db: db, spec: spec}}, nil
+}
+
+// Candles returns the repository of a timeframe as a CandleStore
+func (db *DB) Candles(timeframe models.Timeframe) (CandleStore, error) {
+	repo, err := db.Repository(timeframe)
+	if err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// WithRunID returns a copy of the repository whose upserts record runID as the fetch run
+// which revised the candles they change
+func (r *Repository) WithRunID(runID int64) CandleStore {
+	repo := *r
+	repo.runID = runID
+	return &repo
+}
+
+// Upsert inserts data or updates the existing candles whose values changed, in batches of the
+// batch size of the DB and all in one transaction. The previous values of updated candles are
+// kept in crypto_ohlcv_revisions.
+func (r *Repository) Upsert(data []models.CryptoOHLCV) (UpsertResult, error) {
+	columns, rows := r.rows(data)
+	result, err := r.db.upsertInBatches(r.name(), r.spec.Table, columns, r.conflictColumns(), r.runID, rows)
+	if err == nil {
+		// candles with the same key in data are counted as unchanged
+		result.Unchanged += len(data) - len(rows)
+	}
+	return result, err
+}
+
+// BulkUpsert is like Upsert but loads the rows with COPY, which is much faster for large backfills
+func (r *Repository) BulkUpsert(ctx context.Context, data []models.CryptoOHLCV) (UpsertResult, error) {
+	columns, rows := r.rows(data)
+	result, err := r.db.bulkUpsert(ctx, r.name(), r.spec.Table, columns, r.conflictColumns(), r.runID, rows)
+	if err == nil {
+		result.Unchanged += len(data) - len(rows)
+	}
+	return result, err
+}
+
+// rows converts data to rows of the table of the repository and returns them with their columns.
+// The last candle of a key is kept, ON CONFLICT DO UPDATE cannot update a row twice in a statement.
+func (r *Repository) rows(data []models.CryptoOHLCV) ([]string, [][]interface{}) {
+	columns := ohlcvCopyColumns
+	if r.spec.Aggregated() {
+		columns = aggregatedCopyColumns
+	}
+
+	index := make(map[string]int, len(data))
+	var rows [][]interface{}
+	for i := range data {
+		row := ohlcvCopyRow(&data[i])
+		if r.spec.Aggregated() {
+			row = append([]interface{}{r.spec.BarWidth}, row...)
+		}
+
+		d := &data[i]
+		key := fmt.Sprintf("%s/%s/%s/%d", d.TradingSymbol, d.VsCurrency, d.Exchange, d.Timestamp.UnixNano())
+		if j, ok := index[key]; ok {
+			rows[j] = row
+			continue
+		}
+		index[key] = len(rows)
+		rows = append(rows, row)
+	}
+	return columns, rows
+}
+
+// LatestTimestamp returns the timestamp of the most recent candle of a series, zero if there is none
+func (r *Repository) LatestTimestamp(tradingSymbol string, vsCurrency string, exchange string) (time.Time, error) {
+	var latest sql.NullTime
+	if err := r.latestTimestampQuery(tradingSymbol, vsCurrency, exchange).Row().Scan(&latest); err != nil {
+		r.db.Logger.Errorf("Error getting latest %s timestamp: %v", r.name(), err)
+		return time.Time{}, err
+	}
+	return latest.Time, nil
+}
+
+func (r *Repository) latestTimestampQuery(tradingSymbol string, vsCurrency string, exchange string) *gorm.DB {
+	return r.series(tradingSymbol, vsCurrency, exchange).Select("MAX(timestamp)")
+}
@@ -0,0 +1,274 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"crypto_project/pkg/models"
+)
+
+func TestRepository(t *testing.T) {
+	db := &DB{}
+
+	repo, err := db.Repository(models.TimeframeHourly)
+	require.NoError(t, err)
+	assert.Equal(t, "crypto_ohlcv_hourly_go", repo.spec.Table)
+	assert.False(t, repo.spec.Aggregated())
+
+	tf := models.RegisterAggregatedTimeframe("4h", 4*time.Hour, 0)
+	repo, err = db.Repository(tf)
+	require.NoError(t, err)
+	assert.Equal(t, models.CryptoOHLCVAggregated{}.TableName(), repo.spec.Table)
+	assert.Equal(t, "4h", repo.spec.BarWidth)
+
+	_, err = db.Repository("weekly")
+	assert.Error(t, err)
+}
+
+func TestRepositoryRows(t *testing.T) {
+	db := &DB{}
+	data := []models.CryptoOHLCV{{
+		TradingSymbol: "BTC",
+		VsCurrency:    "USD",
+		Exchange:      models.DefaultExchange,
+		Provider:      "cryptocompare",
+		Timestamp:     time.Unix(1700000000, 0).UTC(),
+		Open:          decimal.RequireFromString("1.5"),
+		High:          decimal.RequireFromString("2"),
+		Low:           decimal.RequireFromString("1"),
+		Close:         decimal.RequireFromString("1.75"),
+		VolumeFrom:    decimal.RequireFromString("10"),
+		VolumeTo:      decimal.RequireFromString("17.5"),
+	}}
+
+	hourly, err := db.Repository(models.TimeframeHourly)
+	require.NoError(t, err)
+	columns, rows := hourly.rows(data)
+	assert.Equal(t, ohlcvCopyColumns, columns)
+	require.Len(t, rows, 1)
+	assert.Len(t, rows[0], len(columns))
+
+	aggregated, err := db.Repository(models.RegisterAggregatedTimeframe("15m", 15*time.Minute, models.MinuteHistory))
+	require.NoError(t, err)
+	columns, rows = aggregated.rows(data)
+	assert.Equal(t, aggregatedCopyColumns, columns)
+	require.Len(t, rows, 1)
+	assert.Equal(t, "15m", rows[0][0])
+	assert.Equal(t, "BTC", rows[0][1])
+
+	// the last candle of a key is kept in the place of the first one
+	restated := data[0]
+	restated.Close = decimal.RequireFromString("1.8")
+	next := data[0]
+	next.Timestamp = next.Timestamp.Add(time.Hour)
+	_, rows = hourly.rows([]models.CryptoOHLCV{data[0], next, restated})
+	require.Len(t, rows, 2)
+	assert.Equal(t, ohlcvCopyRow(&restated), rows[0])
+	assert.Equal(t, ohlcvCopyRow(&next), rows[1])
+}
+
+func TestFromAggregated(t *testing.T) {
+	aggregated := []models.CryptoOHLCVAggregated{{
+		ID:            7,
+		TradingSymbol: "BTC",
+		VsCurrency:    "USD",
+		Exchange:      models.DefaultExchange,
+		Provider:      "cryptocompare",
+		BarWidth:      "15m",
+		Timestamp:     time.Unix(1700000000, 0).UTC(),
+		Open:          decimal.RequireFromString("1.5"),
+		Close:         decimal.RequireFromString("1.75"),
+	}}
+
+	want := []models.CryptoOHLCV{{
+		ID:            7,
+		TradingSymbol: "BTC",
+		VsCurrency:    "USD",
+		Exchange:      models.DefaultExchange,
+		Provider:      "cryptocompare",
+		Timestamp:     time.Unix(1700000000, 0).UTC(),
+		Open:          decimal.RequireFromString("1.5"),
+		Close:         decimal.RequireFromString("1.75"),
+	}}
+	assert.Equal(t, want, fromAggregated(aggregated))
+}
+
+// newDryRunDB returns a DB which builds statements without connecting to a database
+func newDryRunDB(t *testing.T) *DB {
+	g, err := gorm.Open(postgres.Open("host=127.0.0.1 port=1"), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+	})
+	require.NoError(t, err)
+	return &DB{DB: g, batchSize: defaultBatchSize}
+}
+
+func TestRepositoryQueries(t *testing.T) {
+	db := newDryRunDB(t)
+	hourly, err := db.Repository(models.TimeframeHourly)
+	require.NoError(t, err)
+	aggregated, err := db.Repository(models.RegisterAggregatedTimeframe("15m", 15*time.Minute, models.MinuteHistory))
+	require.NoError(t, err)
+
+	from := time.Unix(1700000000, 0).UTC()
+	to := from.Add(24 * time.Hour)
+
+	tests := []struct {
+		name  string
+		query *gorm.DB
+		sql   string
+		vars  []interface{}
+	}{
+		{
+			name:  "range",
+			query: hourly.rangeQuery("BTC", "USD", "CCCAGG", from, to),
+			sql: `SELECT * FROM "crypto_ohlcv_hourly_go" WHERE (trading_symbol = $1 AND vs_currency = $2 AND exchange = $3) ` +
+				`AND (timestamp >= $4 AND timestamp < $5) ORDER BY timestamp asc`,
+			vars: []interface{}{"BTC", "USD", "CCCAGG", from, to},
+		},
+		{
+			name:  "latest",
+			query: hourly.latestQuery(100, "BTC", "USD", "CCCAGG"),
+			sql: `SELECT * FROM "crypto_ohlcv_hourly_go" WHERE trading_symbol = $1 AND vs_currency = $2 AND exchange = $3 ` +
+				`ORDER BY timestamp desc LIMIT 100`,
+			vars: []interface{}{"BTC", "USD", "CCCAGG"},
+		},
+		{
+			name:  "scan first page",
+			query: hourly.scanQuery("BTC", "USD", "CCCAGG", Cursor{}, 500),
+			sql: `SELECT * FROM "crypto_ohlcv_hourly_go" WHERE trading_symbol = $1 AND vs_currency = $2 AND exchange = $3 ` +
+				`ORDER BY timestamp asc LIMIT 500`,
+			vars: []interface{}{"BTC", "USD", "CCCAGG"},
+		},
+		{
+			name:  "scan next page",
+			query: hourly.scanQuery("BTC", "USD", "CCCAGG", Cursor{After: from}, 500),
+			sql: `SELECT * FROM "crypto_ohlcv_hourly_go" WHERE (trading_symbol = $1 AND vs_currency = $2 AND exchange = $3) ` +
+				`AND timestamp > $4 ORDER BY timestamp asc LIMIT 500`,
+			vars: []interface{}{"BTC", "USD", "CCCAGG", from},
+		},
+		{
+			name:  "latest timestamp",
+			query: hourly.latestTimestampQuery("BTC", "USD", "CCCAGG"),
+			sql:   `SELECT MAX(timestamp) FROM "crypto_ohlcv_hourly_go" WHERE trading_symbol = $1 AND vs_currency = $2 AND exchange = $3`,
+			vars:  []interface{}{"BTC", "USD", "CCCAGG"},
+		},
+		{
+			name:  "aggregated latest",
+			query: aggregated.latestQuery(10, "BTC", "USD", "CCCAGG"),
+			sql: `SELECT * FROM "crypto_ohlcv_aggregated_go" WHERE (trading_symbol = $1 AND vs_currency = $2 AND exchange = $3) ` +
+				`AND bar_width = $4 ORDER BY timestamp desc LIMIT 10`,
+			vars: []interface{}{"BTC", "USD", "CCCAGG", "15m"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var data []models.CryptoOHLCV
+			stmt := tt.query.Find(&data).Statement
+			assert.Equal(t, tt.sql, stmt.SQL.String())
+			assert.Equal(t, tt.vars, stmt.Vars)
+		})
+	}
+}
+
+func TestGapsQuery(t *testing.T) {
+	db := newDryRunDB(t)
+	repo, err := db.Repository(models.TimeframeHourly)
+	require.NoError(t, err)
+
+	from := time.Unix(1700002800, 0).UTC()
+	to := from.Add(3 * time.Hour)
+
+	var gaps []Gap
+	stmt := repo.gapsQuery("BTC", "USD", "CCCAGG", from, to).Scan(&gaps).Statement
+
+	want := `WITH missing AS (
+	SELECT e.ts FROM generate_series(CAST($1 AS timestamptz), CAST($2 AS timestamptz), make_interval(secs => $3)) AS e(ts)
+	LEFT JOIN crypto_ohlcv_hourly_go c ON c.timestamp = e.ts AND c.trading_symbol = $4 AND c.vs_currency = $5 AND c.exchange = $6
+	WHERE c.id IS NULL
+)
+SELECT MIN(ts) AS start, MAX(ts) + make_interval(secs => $7) AS "end", COUNT(*) AS missing
+FROM (SELECT ts, ts - ROW_NUMBER() OVER (ORDER BY ts) * make_interval(secs => $8) AS grp FROM missing) m
+GROUP BY grp
+ORDER BY start`
+	assert.Equal(t, want, stmt.SQL.String())
+	// the last expected candle opens an interval before to
+	assert.Equal(t, []interface{}{from, to.Add(-time.Hour), 3600.0, "BTC", "USD", "CCCAGG", 3600.0, 3600.0}, stmt.Vars)
+}
+
+func TestRevisionsQuery(t *testing.T) {
+	db := newDryRunDB(t)
+	repo, err := db.Repository(models.TimeframeDaily)
+	require.NoError(t, err)
+
+	from := time.Unix(1700000000, 0).UTC()
+	to := from.Add(30 * 24 * time.Hour)
+
+	var revisions []models.CryptoOHLCVRevision
+	stmt := repo.revisionsQuery("BTC", "USD", "CCCAGG", from, to).Find(&revisions).Statement
+
+	assert.Equal(t, `SELECT * FROM "crypto_ohlcv_revisions" `+
+		`WHERE (table_name = $1 AND bar_width = $2 AND trading_symbol = $3 AND vs_currency = $4 AND exchange = $5) `+
+		`AND (timestamp >= $6 AND timestamp < $7) ORDER BY timestamp, revised_at, id`, stmt.SQL.String())
+	assert.Equal(t, []interface{}{"crypto_ohlcv_daily_go", "", "BTC", "USD", "CCCAGG", from, to}, stmt.Vars)
+}
+
+func TestAsOfQuery(t *testing.T) {
+	db := newDryRunDB(t)
+	repo, err := db.Repository(models.RegisterAggregatedTimeframe("4h", 4*time.Hour, 0))
+	require.NoError(t, err)
+
+	from := time.Unix(1700000000, 0).UTC()
+	to := from.Add(7 * 24 * time.Hour)
+	asOf := to.Add(24 * time.Hour)
+
+	var data []models.CryptoOHLCVAggregated
+	stmt := repo.asOfQuery("ETH", "USDT", "Binance", from, to, asOf).Find(&data).Statement
+
+	want := `SELECT c.id, c.trading_symbol, c.vs_currency, c.exchange, c.timestamp,
+	COALESCE(v.old_provider, c.provider) AS provider,
+	COALESCE(v.old_open, c.open) AS open,
+	COALESCE(v.old_high, c.high) AS high,
+	COALESCE(v.old_low, c.low) AS low,
+	COALESCE(v.old_close, c.close) AS close,
+	COALESCE(v.old_volume_from, c.volume_from) AS volume_from,
+	COALESCE(v.old_volume_to, c.volume_to) AS volume_to
+FROM crypto_ohlcv_aggregated_go c
+LEFT JOIN LATERAL (
+	SELECT * FROM crypto_ohlcv_revisions rev
+	WHERE rev.table_name = $1 AND rev.bar_width = $2 AND rev.trading_symbol = c.trading_symbol
+		AND rev.vs_currency = c.vs_currency AND rev.exchange = c.exchange AND rev.timestamp = c.timestamp
+		AND rev.revised_at > $3
+	ORDER BY rev.revised_at, rev.id
+	LIMIT 1
+) v ON true
+WHERE c.trading_symbol = $4 AND c.vs_currency = $5 AND c.exchange = $6 AND c.bar_width = $7 AND c.timestamp >= $8 AND c.timestamp < $9 AND c.inserted_at <= $10
+ORDER BY c.timestamp`
+	assert.Equal(t, want, stmt.SQL.String())
+	assert.Equal(t, []interface{}{"crypto_ohlcv_aggregated_go", "4h", asOf, "ETH", "USDT", "Binance", "4h", from, to, asOf}, stmt.Vars)
+}
+
+func TestDeleteBeforeQuery(t *testing.T) {
+	db := newDryRunDB(t)
+	repo, err := db.Repository(models.TimeframeMinute)
+	require.NoError(t, err)
+
+	before := time.Unix(1700000000, 0).UTC()
+
+	var data []models.CryptoOHLCV
+	stmt := repo.deleteBeforeQuery(db.DB, "BTC", "USD", "CCCAGG", before, 10000).Find(&data).Statement
+
+	want := `DELETE FROM crypto_ohlcv_minute_go WHERE timestamp < $1 AND (id, timestamp) IN (
+	SELECT id, timestamp FROM crypto_ohlcv_minute_go WHERE trading_symbol = $2 AND vs_currency = $3 AND exchange = $4 AND timestamp < $5 ORDER BY timestamp LIMIT $6
+) RETURNING *`
+	assert.Equal(t, want, stmt.SQL.String())
+	assert.Equal(t, []interface{}{before, "BTC", "USD", "CCCAGG", before, 10000}, stmt.Vars)
+}
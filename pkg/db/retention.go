@@ -0,0 +1,69 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"crypto_project/pkg/models"
+)
+
+// CountBefore returns how many candles of a series have a timestamp before before
+func (r *Repository) CountBefore(tradingSymbol string, vsCurrency string, exchange string, before time.Time) (int64, error) {
+	var count int64
+	err := r.series(tradingSymbol, vsCurrency, exchange).Where("timestamp < ?", before).Count(&count).Error
+	if err != nil {
+		r.db.Logger.Errorf("Error counting %s data of %s/%s before %v: %v", r.name(), tradingSymbol, vsCurrency, before, err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// DeleteBefore deletes up to limit of the oldest candles of a series with a timestamp before before
+// and returns how many were deleted. archive is given the deleted candles ordered by timestamp
+// before the deletion is committed, the candles are kept if it fails.
+func (r *Repository) DeleteBefore(tradingSymbol string, vsCurrency string, exchange string, before time.Time, limit int, archive func([]models.CryptoOHLCV) error) (int, error) {
+	var deleted int
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		data, err := r.find(r.deleteBeforeQuery(tx, tradingSymbol, vsCurrency, exchange, before, limit))
+		if err != nil || len(data) == 0 {
+			return err
+		}
+
+		sort.Slice(data, func(i, j int) bool { return data[i].Timestamp.Before(data[j].Timestamp) })
+		if err := archive(data); err != nil {
+			return err
+		}
+		deleted = len(data)
+		return nil
+	})
+	if err != nil {
+		r.db.Logger.Errorf("Error deleting %s data of %s/%s before %v: %v", r.name(), tradingSymbol, vsCurrency, before, err)
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// deleteBeforeQuery deletes the oldest candles of a series before before and returns them, rows are
+// selected by (id, timestamp) as id alone is not unique in partitioned tables and hypertables
+func (r *Repository) deleteBeforeQuery(tx *gorm.DB, tradingSymbol string, vsCurrency string, exchange string, before time.Time, limit int) *gorm.DB {
+	where := "trading_symbol = @symbol AND vs_currency = @vs AND exchange = @exchange"
+	if r.spec.Aggregated() {
+		where += " AND bar_width = @bar_width"
+	}
+
+	sql := fmt.Sprintf(`DELETE FROM %s WHERE timestamp < @before AND (id, timestamp) IN (
+	SELECT id, timestamp FROM %s WHERE %s AND timestamp < @before ORDER BY timestamp LIMIT @limit
+) RETURNING *`, r.spec.Table, r.spec.Table, where)
+
+	return tx.Raw(sql, map[string]interface{}{
+		"symbol":    tradingSymbol,
+		"vs":        vsCurrency,
+		"exchange":  exchange,
+		"bar_width": r.spec.BarWidth,
+		"before":    before,
+		"limit":     limit,
+	})
+}
@@ -0,0 +1,96 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"crypto_project/pkg/models"
+)
+
+// fetchRunIDSetting is the transaction setting the trigger recording revisions reads the fetch run from
+const fetchRunIDSetting = "crypto_project.fetch_run_id"
+
+// revisionTriggerSQL returns the statement creating the trigger which records revisions of the
+// candles of table, as created by the migrations for tables which are recreated
+func revisionTriggerSQL(table string) string {
+	changed := make([]string, len(ohlcvUpdateColumns))
+	for i, c := range ohlcvUpdateColumns {
+		changed[i] = fmt.Sprintf("OLD.%s IS DISTINCT FROM NEW.%s", c, c)
+	}
+	return fmt.Sprintf("CREATE TRIGGER trg_%s_revision AFTER UPDATE ON %s FOR EACH ROW WHEN (%s) "+
+		"EXECUTE FUNCTION record_ohlcv_revision('%s')", table, table, strings.Join(changed, " OR "), table)
+}
+
+// AsOf returns the candles of a series with a timestamp in [from, to) ordered by timestamp, as they
+// were stored at asOf. Candles inserted after asOf are left out and candles revised after asOf have
+// the values they had before the first of those revisions, so a backtest run again reads the same data.
+func (r *Repository) AsOf(tradingSymbol string, vsCurrency string, exchange string, from time.Time, to time.Time, asOf time.Time) ([]models.CryptoOHLCV, error) {
+	data, err := r.find(r.asOfQuery(tradingSymbol, vsCurrency, exchange, from, to, asOf))
+	if err != nil {
+		r.db.Logger.Errorf("Error getting %s data from %v to %v as of %v: %v", r.name(), from, to, asOf, err)
+		return nil, err
+	}
+	return data, nil
+}
+
+// Revisions returns the revisions of the candles of a series with a timestamp in [from, to),
+// ordered by timestamp and then by when they were revised
+func (r *Repository) Revisions(tradingSymbol string, vsCurrency string, exchange string, from time.Time, to time.Time) ([]models.CryptoOHLCVRevision, error) {
+	var revisions []models.CryptoOHLCVRevision
+	if err := r.revisionsQuery(tradingSymbol, vsCurrency, exchange, from, to).Find(&revisions).Error; err != nil {
+		r.db.Logger.Errorf("Error getting revisions of %s data from %v to %v: %v", r.name(), from, to, err)
+		return nil, err
+	}
+	return revisions, nil
+}
+
+func (r *Repository) revisionsQuery(tradingSymbol string, vsCurrency string, exchange string, from time.Time, to time.Time) *gorm.DB {
+	return r.db.Model(&models.CryptoOHLCVRevision{}).
+		Where("table_name = ? AND bar_width = ? AND trading_symbol = ? AND vs_currency = ? AND exchange = ?",
+			r.spec.Table, r.spec.BarWidth, tradingSymbol, vsCurrency, exchange).
+		Where("timestamp >= ? AND timestamp < ?", from, to).
+		Order("timestamp, revised_at, id")
+}
+
+// asOfQuery joins every candle with its first revision after asOf, whose old values are the
+// values of the candle at asOf
+func (r *Repository) asOfQuery(tradingSymbol string, vsCurrency string, exchange string, from time.Time, to time.Time, asOf time.Time) *gorm.DB {
+	where := "c.trading_symbol = @symbol AND c.vs_currency = @vs AND c.exchange = @exchange"
+	if r.spec.Aggregated() {
+		where += " AND c.bar_width = @bar_width"
+	}
+
+	sql := fmt.Sprintf(`SELECT c.id, c.trading_symbol, c.vs_currency, c.exchange, c.timestamp,
+	COALESCE(v.old_provider, c.provider) AS provider,
+	COALESCE(v.old_open, c.open) AS open,
+	COALESCE(v.old_high, c.high) AS high,
+	COALESCE(v.old_low, c.low) AS low,
+	COALESCE(v.old_close, c.close) AS close,
+	COALESCE(v.old_volume_from, c.volume_from) AS volume_from,
+	COALESCE(v.old_volume_to, c.volume_to) AS volume_to
+FROM %s c
+LEFT JOIN LATERAL (
+	SELECT * FROM crypto_ohlcv_revisions rev
+	WHERE rev.table_name = @table AND rev.bar_width = @bar_width AND rev.trading_symbol = c.trading_symbol
+		AND rev.vs_currency = c.vs_currency AND rev.exchange = c.exchange AND rev.timestamp = c.timestamp
+		AND rev.revised_at > @as_of
+	ORDER BY rev.revised_at, rev.id
+	LIMIT 1
+) v ON true
+WHERE %s AND c.timestamp >= @from AND c.timestamp < @to AND c.inserted_at <= @as_of
+ORDER BY c.timestamp`, r.spec.Table, where)
+
+	return r.db.Raw(sql, map[string]interface{}{
+		"table":     r.spec.Table,
+		"bar_width": r.spec.BarWidth,
+		"symbol":    tradingSymbol,
+		"vs":        vsCurrency,
+		"exchange":  exchange,
+		"from":      from,
+		"to":        to,
+		"as_of":     asOf,
+	})
+}
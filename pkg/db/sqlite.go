@@ -0,0 +1,364 @@
+package db
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/sirupsen/logrus"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"crypto_project/pkg/models"
+)
+
+//go:embed sqlite/schema.sql
+var sqliteSchema string
+
+// SQLiteDB is the storage backend of a local SQLite database file, for development without a
+// PostgreSQL server. Candles are upserted like in PostgreSQL, but revisions of candles are not
+// recorded and the schema is created when the database is opened instead of by migrations.
+//
+// Only the methods of Storage are exposed, the other methods of DB need PostgreSQL.
+type SQLiteDB struct {
+	db *DB
+}
+
+// sqliteRepository reads and writes the candles of one timeframe in SQLite
+type sqliteRepository struct {
+	candleTable
+}
+
+// NewSQLiteDB opens the SQLite database at path, creating it and its tables if they do not exist
+func NewSQLiteDB(path string, logger *logrus.Logger, opts ...Option) (*SQLiteDB, error) {
+	g, err := gorm.Open(sqlite.Open(sqliteDSN(path)), &gorm.Config{})
+	if err != nil {
+		logger.Errorf("Error opening SQLite database %s: %v", path, err)
+		return nil, err
+	}
+
+	// SQLite has a single writer, save workers wait for the connection instead of failing as busy
+	sqlDB, err := g.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	d := &DB{DB: g, Logger: logger, batchSize: defaultBatchSize}
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	if err := g.Exec(sqliteSchema).Error; err != nil {
+		logger.Errorf("Error creating SQLite schema: %v", err)
+		return nil, err
+	}
+	return &SQLiteDB{db: d}, nil
+}
+
+// sqliteDSN enables foreign keys, which SQLite does not enforce by default
+func sqliteDSN(path string) string {
+	if strings.Contains(path, "?") {
+		return path + "&_foreign_keys=on"
+	}
+	return path + "?_foreign_keys=on"
+}
+
+// Candles returns the store of the candles of a timeframe registered with models.RegisterTimeframe
+func (db *SQLiteDB) Candles(timeframe models.Timeframe) (CandleStore, error) {
+	spec, err := models.LookupTimeframe(timeframe)
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteRepository{candleTable: candleTable{db: db.db, spec: spec}}, nil
+}
+
+// StartFetchRun records the start of a fetch run
+func (db *SQLiteDB) StartFetchRun(mode string, configHash string) (*models.FetchRun, error) {
+	return db.db.StartFetchRun(mode, configHash)
+}
+
+// FinishFetchRun records the end of a fetch run, errMsg is stored if it is not empty
+func (db *SQLiteDB) FinishFetchRun(run *models.FetchRun, status string, errMsg string) error {
+	return db.db.FinishFetchRun(run, status, errMsg)
+}
+
+// StartFetchJob records the start of a job of a fetch run, the ID of job is set on success
+func (db *SQLiteDB) StartFetchJob(job *models.FetchJob) error {
+	return db.db.StartFetchJob(job)
+}
+
+// AddFetchJobProgress adds fetched pages and rows, and the result of saving rows to the counts of a fetch job
+func (db *SQLiteDB) AddFetchJobProgress(jobID int64, pages int, rowsFetched int, saved UpsertResult) error {
+	return db.db.AddFetchJobProgress(jobID, pages, rowsFetched, saved)
+}
+
+// FinishFetchJob records the end of a fetch job, errMsg is stored if it is not empty
+func (db *SQLiteDB) FinishFetchJob(jobID int64, status string, errMsg string) error {
+	return db.db.FinishFetchJob(jobID, status, errMsg)
+}
+
+// LatestFetchRun returns the most recently started fetch run, nil if there is none
+func (db *SQLiteDB) LatestFetchRun() (*models.FetchRun, error) {
+	return db.db.LatestFetchRun()
+}
+
+// UnsuccessfulFetchJobs returns the jobs of a fetch run which did not succeed
+func (db *SQLiteDB) UnsuccessfulFetchJobs(runID int64) ([]models.FetchJob, error) {
+	return db.db.UnsuccessfulFetchJobs(runID)
+}
+
+// LastSuccessfulFetchJob returns the most recent successful fetch job of a series, nil if there is none
+func (db *SQLiteDB) LastSuccessfulFetchJob(tradingSymbol string, vsCurrency string, exchange string, timeframe models.Timeframe) (*models.FetchJob, error) {
+	return db.db.LastSuccessfulFetchJob(tradingSymbol, vsCurrency, exchange, timeframe)
+}
+
+// Close closes the database file
+func (db *SQLiteDB) Close() error {
+	return db.db.Close()
+}
+
+// WithRunID returns the repository itself, revisions of candles are not recorded in SQLite
+func (r *sqliteRepository) WithRunID(runID int64) CandleStore {
+	return r
+}
+
+// Upsert inserts data or updates the existing candles whose values changed, in batches of the
+// batch size of the DB and all in one transaction
+func (r *sqliteRepository) Upsert(data []models.CryptoOHLCV) (UpsertResult, error) {
+	var result UpsertResult
+	if len(data) == 0 {
+		return result, nil
+	}
+
+	columns := ohlcvCopyColumns
+	if r.spec.Aggregated() {
+		columns = aggregatedCopyColumns
+	}
+	var keys []string
+	for _, c := range r.conflictColumns() {
+		keys = append(keys, c.Name)
+	}
+
+	r.db.Logger.Tracef("Starting saving %s data", r.name())
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		for start := 0; start < len(data); start += r.db.batchSize {
+			end := start + r.db.batchSize
+			if end > len(data) {
+				end = len(data)
+			}
+
+			batch := r.rows(data[start:end])
+			counts, err := sqliteUpsertBatch(tx, r.spec.Table, columns, keys, batch)
+			if err != nil {
+				return err
+			}
+			// candles with the same key in the batch are counted as unchanged
+			counts.Unchanged += end - start - len(batch)
+			result.Add(counts)
+		}
+		return nil
+	})
+	if err != nil {
+		r.db.Logger.Errorf("Error saving %s data: %v", r.name(), err)
+		return UpsertResult{}, err
+	}
+	r.db.Logger.Tracef("Successfully saved %s data, %s", r.name(), result)
+	return result, nil
+}
+
+// BulkUpsert is Upsert, SQLite has no faster way to load rows
+func (r *sqliteRepository) BulkUpsert(ctx context.Context, data []models.CryptoOHLCV) (UpsertResult, error) {
+	return r.Upsert(data)
+}
+
+// rows converts data to rows of the table of the repository, the last candle of a key is kept.
+// Decimals are passed as text and timestamps in UTC.
+func (r *sqliteRepository) rows(data []models.CryptoOHLCV) [][]interface{} {
+	index := make(map[string]int, len(data))
+	var rows [][]interface{}
+	for _, d := range data {
+		row := []interface{}{
+			d.TradingSymbol, d.VsCurrency, d.Exchange, d.Provider, d.Timestamp.UTC(),
+			d.Open.String(), d.High.String(), d.Low.String(), d.Close.String(), d.VolumeFrom.String(), d.VolumeTo.String(),
+		}
+		if r.spec.Aggregated() {
+			row = append([]interface{}{r.spec.BarWidth}, row...)
+		}
+
+		key := fmt.Sprintf("%s/%s/%s/%d", d.TradingSymbol, d.VsCurrency, d.Exchange, d.Timestamp.UnixNano())
+		if i, ok := index[key]; ok {
+			rows[i] = row
+			continue
+		}
+		index[key] = len(rows)
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// sqliteUpsertBatch upserts rows with distinct keys. SQLite does not tell inserted from updated
+// rows, so the rows which already exist are counted first, the rows changed by the upsert are
+// the inserted and the updated ones.
+func sqliteUpsertBatch(tx *gorm.DB, table string, columns []string, keys []string, rows [][]interface{}) (UpsertResult, error) {
+	var keyArgs, args []interface{}
+	for _, row := range rows {
+		for i, c := range columns {
+			if contains(keys, c) {
+				keyArgs = append(keyArgs, row[i])
+			}
+		}
+		args = append(args, row...)
+	}
+
+	var existing int
+	if err := tx.Raw(sqliteExistingSQL(table, columns, keys, len(rows)), keyArgs...).Row().Scan(&existing); err != nil {
+		return UpsertResult{}, err
+	}
+
+	upsert := tx.Exec(sqliteUpsertSQL(table, columns, keys, len(rows)), args...)
+	if upsert.Error != nil {
+		return UpsertResult{}, upsert.Error
+	}
+
+	inserted := len(rows) - existing
+	updated := int(upsert.RowsAffected) - inserted
+	return UpsertResult{Inserted: inserted, Updated: updated, Unchanged: len(rows) - inserted - updated}, nil
+}
+
+// sqliteExistingSQL builds the statement counting the rows of table with the keys of n rows,
+// the keys are given in the order of columns
+func sqliteExistingSQL(table string, columns []string, keys []string, n int) string {
+	var ordered []string
+	for _, c := range columns {
+		if contains(keys, c) {
+			ordered = append(ordered, c)
+		}
+	}
+	return fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE (%s) IN (%s)",
+		table, strings.Join(ordered, ", "), valuesList(n, len(ordered)))
+}
+
+// sqliteUpsertSQL builds the statement inserting n rows into table, existing rows are only
+// updated if a value changed
+func sqliteUpsertSQL(table string, columns []string, keys []string, n int) string {
+	updates := make([]string, len(ohlcvUpdateColumns))
+	changed := make([]string, len(ohlcvUpdateColumns))
+	for i, c := range ohlcvUpdateColumns {
+		updates[i] = fmt.Sprintf("%s = excluded.%s", c, c)
+		changed[i] = fmt.Sprintf("%s.%s IS NOT excluded.%s", table, c, c)
+	}
+
+	return fmt.Sprintf("INSERT INTO %s (%s) %s ON CONFLICT (%s) DO UPDATE SET %s WHERE %s",
+		table, strings.Join(columns, ", "), valuesList(n, len(columns)),
+		strings.Join(keys, ", "), strings.Join(updates, ", "), strings.Join(changed, " OR "))
+}
+
+// LatestTimestamp returns the timestamp of the most recent candle of a series, zero if there is none
+func (r *sqliteRepository) LatestTimestamp(tradingSymbol string, vsCurrency string, exchange string) (time.Time, error) {
+	// unlike MAX the column keeps its type, so SQLite returns a time
+	var latest []time.Time
+	err := r.series(tradingSymbol, vsCurrency, exchange).Order("timestamp desc").Limit(1).Pluck("timestamp", &latest).Error
+	if err != nil {
+		r.db.Logger.Errorf("Error getting latest %s timestamp: %v", r.name(), err)
+		return time.Time{}, err
+	}
+	if len(latest) == 0 {
+		return time.Time{}, nil
+	}
+	return latest[0], nil
+}
+
+// Series returns every series stored in the repository
+func (r *sqliteRepository) Series() ([]Series, error) {
+	// MIN and MAX of the timestamps are returned as text
+	var rows []struct {
+		TradingSymbol string
+		VsCurrency    string
+		Exchange      string
+		First         string
+		Last          string
+	}
+	if err := r.seriesQuery().Scan(&rows).Error; err != nil {
+		r.db.Logger.Errorf("Error listing %s series: %v", r.name(), err)
+		return nil, err
+	}
+
+	series := make([]Series, len(rows))
+	for i, row := range rows {
+		first, err := parseSQLiteTime(row.First)
+		if err != nil {
+			return nil, err
+		}
+		last, err := parseSQLiteTime(row.Last)
+		if err != nil {
+			return nil, err
+		}
+		series[i] = Series{TradingSymbol: row.TradingSymbol, VsCurrency: row.VsCurrency, Exchange: row.Exchange, First: first, Last: last}
+	}
+	return series, nil
+}
+
+// Gaps returns the runs of candles missing from a series in [from, to), from is aligned down
+// to the interval of the repository
+func (r *sqliteRepository) Gaps(tradingSymbol string, vsCurrency string, exchange string, from time.Time, to time.Time) ([]Gap, error) {
+	from = from.Truncate(r.spec.Interval)
+	if !to.After(from) {
+		return nil, nil
+	}
+
+	var stored []time.Time
+	err := r.rangeQuery(tradingSymbol, vsCurrency, exchange, from, to).Pluck("timestamp", &stored).Error
+	if err != nil {
+		r.db.Logger.Errorf("Error scanning %s gaps of %s/%s: %v", r.name(), tradingSymbol, vsCurrency, err)
+		return nil, err
+	}
+	return findGaps(from, to, r.spec.Interval, stored), nil
+}
+
+// findGaps returns the runs of timestamps every interval from from, before to, which are not in
+// stored. stored must be sorted.
+func findGaps(from time.Time, to time.Time, interval time.Duration, stored []time.Time) []Gap {
+	var gaps []Gap
+	var gap *Gap
+	i := 0
+	for ts := from; ts.Before(to); ts = ts.Add(interval) {
+		for i < len(stored) && stored[i].Before(ts) {
+			i++
+		}
+		if i < len(stored) && stored[i].Equal(ts) {
+			gap = nil
+			continue
+		}
+
+		if gap == nil {
+			gaps = append(gaps, Gap{Start: ts})
+			gap = &gaps[len(gaps)-1]
+		}
+		gap.End = ts.Add(interval)
+		gap.Missing++
+	}
+	return gaps
+}
+
+// parseSQLiteTime parses a timestamp as stored by the SQLite driver
+func parseSQLiteTime(s string) (time.Time, error) {
+	for _, layout := range sqlite3.SQLiteTimestampFormats {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid SQLite timestamp: %s", s)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
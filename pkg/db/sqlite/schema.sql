@@ -0,0 +1,100 @@
+-- Schema of the SQLite storage backend, created when the database is opened. Prices and
+-- volumes are stored as text so no decimal digit is lost.
+CREATE TABLE IF NOT EXISTS crypto_ohlcv_minute_go (
+    id             INTEGER PRIMARY KEY AUTOINCREMENT,
+    trading_symbol TEXT     NOT NULL,
+    vs_currency    TEXT     NOT NULL,
+    exchange       TEXT     NOT NULL DEFAULT 'CCCAGG',
+    provider       TEXT     NOT NULL DEFAULT 'cryptocompare',
+    timestamp      DATETIME NOT NULL,
+    open           TEXT     NOT NULL,
+    high           TEXT     NOT NULL,
+    low            TEXT     NOT NULL,
+    close          TEXT     NOT NULL,
+    volume_from    TEXT     NOT NULL,
+    volume_to      TEXT     NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_crypto_ohlcv_minute_go_tpair_ts ON crypto_ohlcv_minute_go (trading_symbol, vs_currency, exchange, timestamp);
+
+CREATE TABLE IF NOT EXISTS crypto_ohlcv_hourly_go (
+    id             INTEGER PRIMARY KEY AUTOINCREMENT,
+    trading_symbol TEXT     NOT NULL,
+    vs_currency    TEXT     NOT NULL,
+    exchange       TEXT     NOT NULL DEFAULT 'CCCAGG',
+    provider       TEXT     NOT NULL DEFAULT 'cryptocompare',
+    timestamp      DATETIME NOT NULL,
+    open           TEXT     NOT NULL,
+    high           TEXT     NOT NULL,
+    low            TEXT     NOT NULL,
+    close          TEXT     NOT NULL,
+    volume_from    TEXT     NOT NULL,
+    volume_to      TEXT     NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_crypto_ohlcv_hourly_go_tpair_ts ON crypto_ohlcv_hourly_go (trading_symbol, vs_currency, exchange, timestamp);
+
+CREATE TABLE IF NOT EXISTS crypto_ohlcv_daily_go (
+    id             INTEGER PRIMARY KEY AUTOINCREMENT,
+    trading_symbol TEXT     NOT NULL,
+    vs_currency    TEXT     NOT NULL,
+    exchange       TEXT     NOT NULL DEFAULT 'CCCAGG',
+    provider       TEXT     NOT NULL DEFAULT 'cryptocompare',
+    timestamp      DATETIME NOT NULL,
+    open           TEXT     NOT NULL,
+    high           TEXT     NOT NULL,
+    low            TEXT     NOT NULL,
+    close          TEXT     NOT NULL,
+    volume_from    TEXT     NOT NULL,
+    volume_to      TEXT     NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_crypto_ohlcv_daily_go_tpair_ts ON crypto_ohlcv_daily_go (trading_symbol, vs_currency, exchange, timestamp);
+
+CREATE TABLE IF NOT EXISTS crypto_ohlcv_aggregated_go (
+    id             INTEGER PRIMARY KEY AUTOINCREMENT,
+    trading_symbol TEXT     NOT NULL,
+    vs_currency    TEXT     NOT NULL,
+    exchange       TEXT     NOT NULL DEFAULT 'CCCAGG',
+    provider       TEXT     NOT NULL DEFAULT 'cryptocompare',
+    bar_width      TEXT     NOT NULL,
+    timestamp      DATETIME NOT NULL,
+    open           TEXT     NOT NULL,
+    high           TEXT     NOT NULL,
+    low            TEXT     NOT NULL,
+    close          TEXT     NOT NULL,
+    volume_from    TEXT     NOT NULL,
+    volume_to      TEXT     NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_crypto_ohlcv_aggregated_go_tpair_width_ts
+    ON crypto_ohlcv_aggregated_go (trading_symbol, vs_currency, exchange, bar_width, timestamp);
+
+CREATE TABLE IF NOT EXISTS fetch_runs (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    mode        TEXT     NOT NULL,
+    config_hash TEXT     NOT NULL,
+    started_at  DATETIME NOT NULL,
+    finished_at DATETIME,
+    status      TEXT     NOT NULL,
+    error       TEXT
+);
+
+CREATE TABLE IF NOT EXISTS fetch_jobs (
+    id             INTEGER PRIMARY KEY AUTOINCREMENT,
+    run_id         INTEGER  NOT NULL REFERENCES fetch_runs (id) ON DELETE CASCADE,
+    trading_symbol TEXT     NOT NULL,
+    vs_currency    TEXT     NOT NULL,
+    exchange       TEXT     NOT NULL,
+    provider       TEXT     NOT NULL,
+    timeframe      TEXT     NOT NULL,
+    "limit"        INTEGER  NOT NULL,
+    since          DATETIME,
+    started_at     DATETIME NOT NULL,
+    finished_at    DATETIME,
+    pages          INTEGER  NOT NULL DEFAULT 0,
+    rows_fetched   INTEGER  NOT NULL DEFAULT 0,
+    rows_inserted  INTEGER  NOT NULL DEFAULT 0,
+    rows_updated   INTEGER  NOT NULL DEFAULT 0,
+    rows_unchanged INTEGER  NOT NULL DEFAULT 0,
+    status         TEXT     NOT NULL,
+    error          TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_fetch_jobs_run ON fetch_jobs (run_id);
+CREATE INDEX IF NOT EXISTS idx_fetch_jobs_series ON fetch_jobs (trading_symbol, vs_currency, exchange, timeframe, status, finished_at);
@@ -0,0 +1,183 @@
+package db
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"crypto_project/pkg/models"
+)
+
+func newSQLiteDB(t *testing.T, opts ...Option) *SQLiteDB {
+	t.Helper()
+	logger := logrus.New()
+	logger.Out = io.Discard
+
+	db, err := NewSQLiteDB(":memory:", logger, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func sqliteCandle(ts time.Time, close string) models.CryptoOHLCV {
+	return models.CryptoOHLCV{
+		TradingSymbol: "BTC",
+		VsCurrency:    "USD",
+		Exchange:      "CCCAGG",
+		Provider:      "cryptocompare",
+		Timestamp:     ts,
+		Open:          decimal.RequireFromString("37000.12345678"),
+		High:          decimal.RequireFromString("37100.5"),
+		Low:           decimal.RequireFromString("36900"),
+		Close:         decimal.RequireFromString(close),
+		VolumeFrom:    decimal.RequireFromString("0.00000001"),
+		VolumeTo:      decimal.RequireFromString("123456789012345678.123456789"),
+	}
+}
+
+func TestSQLiteUpsert(t *testing.T) {
+	db := newSQLiteDB(t, WithBatchSize(2))
+	repo, err := db.Candles(models.TimeframeHourly)
+	require.NoError(t, err)
+
+	start := time.Unix(1700000000, 0).Truncate(time.Hour)
+	data := []models.CryptoOHLCV{
+		sqliteCandle(start, "37050.1"),
+		sqliteCandle(start.Add(time.Hour), "37060.2"),
+		sqliteCandle(start.Add(2*time.Hour), "37070.3"),
+	}
+
+	result, err := repo.Upsert(data)
+	require.NoError(t, err)
+	assert.Equal(t, UpsertResult{Inserted: 3}, result)
+
+	// a restated candle, an unchanged one, a duplicate of it and a new one
+	data = []models.CryptoOHLCV{
+		sqliteCandle(start.Add(time.Hour), "37061"),
+		sqliteCandle(start.Add(2*time.Hour), "37070.3"),
+		sqliteCandle(start.Add(2*time.Hour), "37070.3"),
+		sqliteCandle(start.Add(3*time.Hour), "37080.4"),
+	}
+	result, err = repo.BulkUpsert(context.Background(), data)
+	require.NoError(t, err)
+	assert.Equal(t, UpsertResult{Inserted: 1, Updated: 1, Unchanged: 2}, result)
+
+	stored, err := repo.Get(10, "BTC", "USD", "CCCAGG")
+	require.NoError(t, err)
+	require.Len(t, stored, 4)
+	for i, d := range stored {
+		assert.True(t, d.Timestamp.Equal(start.Add(time.Duration(i)*time.Hour)))
+	}
+	// decimals keep every digit
+	assert.Equal(t, "37000.12345678", stored[0].Open.String())
+	assert.Equal(t, "0.00000001", stored[0].VolumeFrom.String())
+	assert.Equal(t, "123456789012345678.123456789", stored[0].VolumeTo.String())
+	assert.Equal(t, "37061", stored[1].Close.String())
+}
+
+func TestSQLiteQueries(t *testing.T) {
+	db := newSQLiteDB(t)
+	repo, err := db.Candles(models.RegisterAggregatedTimeframe("4h", 4*time.Hour, 0))
+	require.NoError(t, err)
+
+	taipei := time.FixedZone("Asia/Taipei", 8*60*60)
+	start := time.Unix(1700006400, 0).In(taipei)
+	var data []models.CryptoOHLCV
+	for i := 0; i < 6; i++ {
+		if i == 2 || i == 3 {
+			continue
+		}
+		data = append(data, sqliteCandle(start.Add(time.Duration(i)*4*time.Hour), "37000"))
+	}
+	_, err = repo.Upsert(data)
+	require.NoError(t, err)
+
+	latest, err := repo.LatestTimestamp("BTC", "USD", "CCCAGG")
+	require.NoError(t, err)
+	assert.True(t, latest.Equal(start.Add(20*time.Hour)))
+
+	none, err := repo.LatestTimestamp("ETH", "USD", "CCCAGG")
+	require.NoError(t, err)
+	assert.True(t, none.IsZero())
+
+	// times of other zones are compared as the same instants
+	inRange, err := repo.Range("BTC", "USD", "CCCAGG", start.Add(4*time.Hour), start.Add(20*time.Hour))
+	require.NoError(t, err)
+	assert.Len(t, inRange, 2)
+
+	page, cursor, err := repo.Scan("BTC", "USD", "CCCAGG", Cursor{}, 3)
+	require.NoError(t, err)
+	assert.Len(t, page, 3)
+	page, _, err = repo.Scan("BTC", "USD", "CCCAGG", cursor, 3)
+	require.NoError(t, err)
+	assert.Len(t, page, 1)
+
+	series, err := repo.Series()
+	require.NoError(t, err)
+	require.Len(t, series, 1)
+	assert.True(t, series[0].First.Equal(start))
+	assert.True(t, series[0].Last.Equal(start.Add(20*time.Hour)))
+
+	gaps, err := repo.Gaps("BTC", "USD", "CCCAGG", start, start.Add(24*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, gaps, 1)
+	assert.True(t, gaps[0].Start.Equal(start.Add(8*time.Hour)))
+	assert.True(t, gaps[0].End.Equal(start.Add(16*time.Hour)))
+	assert.Equal(t, 2, gaps[0].Missing)
+}
+
+func TestSQLiteLedger(t *testing.T) {
+	db := newSQLiteDB(t)
+
+	run, err := db.StartFetchRun("recent", "hash")
+	require.NoError(t, err)
+	job := &models.FetchJob{RunID: run.ID, TradingSymbol: "BTC", VsCurrency: "USD", Exchange: "CCCAGG",
+		Provider: "cryptocompare", Timeframe: models.TimeframeHourly, Limit: 24}
+	require.NoError(t, db.StartFetchJob(job))
+	require.NoError(t, db.AddFetchJobProgress(job.ID, 1, 24, UpsertResult{Inserted: 20, Updated: 1, Unchanged: 3}))
+	require.NoError(t, db.FinishFetchJob(job.ID, models.FetchStatusFailed, "boom"))
+	require.NoError(t, db.FinishFetchRun(run, models.FetchStatusFailed, "1 of 1 jobs failed"))
+
+	latest, err := db.LatestFetchRun()
+	require.NoError(t, err)
+	require.NotNil(t, latest)
+	assert.Equal(t, run.ID, latest.ID)
+
+	jobs, err := db.UnsuccessfulFetchJobs(run.ID)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, 1, jobs[0].Pages)
+	assert.Equal(t, 20, jobs[0].RowsInserted)
+	assert.Equal(t, 1, jobs[0].RowsUpdated)
+	assert.Equal(t, 3, jobs[0].RowsUnchanged)
+	assert.Equal(t, "boom", *jobs[0].Error)
+
+	last, err := db.LastSuccessfulFetchJob("BTC", "USD", "CCCAGG", models.TimeframeHourly)
+	require.NoError(t, err)
+	assert.Nil(t, last)
+}
+
+func TestFindGaps(t *testing.T) {
+	from := time.Unix(1700000000, 0).UTC().Truncate(time.Hour)
+	at := func(hours ...int) []time.Time {
+		var ts []time.Time
+		for _, h := range hours {
+			ts = append(ts, from.Add(time.Duration(h)*time.Hour))
+		}
+		return ts
+	}
+
+	gaps := findGaps(from, from.Add(6*time.Hour), time.Hour, at(0, 3, 4))
+	assert.Equal(t, []Gap{
+		{Start: from.Add(time.Hour), End: from.Add(3 * time.Hour), Missing: 2},
+		{Start: from.Add(5 * time.Hour), End: from.Add(6 * time.Hour), Missing: 1},
+	}, gaps)
+
+	assert.Empty(t, findGaps(from, from.Add(2*time.Hour), time.Hour, at(0, 1)))
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"crypto_project/pkg/models"
+)
+
+// Storage drivers selected by the driver setting of [database]
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// CandleStore reads and writes the candles of one timeframe
+type CandleStore interface {
+	Timeframe() models.Timeframe
+	Spec() models.TimeframeSpec
+	// WithRunID returns a store whose upserts record runID as the fetch run which revised the candles they change
+	WithRunID(runID int64) CandleStore
+	Upsert(data []models.CryptoOHLCV) (UpsertResult, error)
+	BulkUpsert(ctx context.Context, data []models.CryptoOHLCV) (UpsertResult, error)
+	Get(limit int, tradingSymbol string, vsCurrency string, exchange string) ([]models.CryptoOHLCV, error)
+	Range(tradingSymbol string, vsCurrency string, exchange string, from time.Time, to time.Time) ([]models.CryptoOHLCV, error)
+	Latest(n int, tradingSymbol string, vsCurrency string, exchange string) ([]models.CryptoOHLCV, error)
+	Scan(tradingSymbol string, vsCurrency string, exchange string, cursor Cursor, pageSize int) ([]models.CryptoOHLCV, Cursor, error)
+	LatestTimestamp(tradingSymbol string, vsCurrency string, exchange string) (time.Time, error)
+	Series() ([]Series, error)
+	Gaps(tradingSymbol string, vsCurrency string, exchange string, from time.Time, to time.Time) ([]Gap, error)
+}
+
+// Storage is a storage backend of candles and of the fetch ledger
+type Storage interface {
+	// Candles returns the store of the candles of a timeframe registered with models.RegisterTimeframe
+	Candles(timeframe models.Timeframe) (CandleStore, error)
+
+	StartFetchRun(mode string, configHash string) (*models.FetchRun, error)
+	FinishFetchRun(run *models.FetchRun, status string, errMsg string) error
+	StartFetchJob(job *models.FetchJob) error
+	AddFetchJobProgress(jobID int64, pages int, rowsFetched int, saved UpsertResult) error
+	FinishFetchJob(jobID int64, status string, errMsg string) error
+	LatestFetchRun() (*models.FetchRun, error)
+	UnsuccessfulFetchJobs(runID int64) ([]models.FetchJob, error)
+	LastSuccessfulFetchJob(tradingSymbol string, vsCurrency string, exchange string, timeframe models.Timeframe) (*models.FetchJob, error)
+
+	Close() error
+}
+
+// Open opens the storage backend of driver, DriverPostgres if it is empty. The dsn of DriverSQLite
+// is the path of the database file.
+func Open(driver string, dsn string, logger *logrus.Logger, opts ...Option) (Storage, error) {
+	// a nil *DB must not be returned as a non-nil Storage
+	switch driver {
+	case "", DriverPostgres:
+		db, err := NewDB(dsn, logger, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	case DriverSQLite:
+		db, err := NewSQLiteDB(dsn, logger, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	default:
+		return nil, fmt.Errorf("invalid database driver: %s", driver)
+	}
+}
+
+var (
+	_ Storage     = (*DB)(nil)
+	_ Storage     = (*SQLiteDB)(nil)
+	_ CandleStore = (*Repository)(nil)
+	_ CandleStore = (*sqliteRepository)(nil)
+)
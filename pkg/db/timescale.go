@@ -0,0 +1,109 @@
+package db
+
+import (
+	"fmt"
+)
+
+// hypertable is how a candle table is stored when it is a TimescaleDB hypertable
+type hypertable struct {
+	table string
+	// chunkInterval is the time span of a chunk of the hypertable
+	chunkInterval string
+	// compressAfter is the age from which chunks are compressed
+	compressAfter string
+}
+
+// rollup is a continuous aggregate rolling minute candles up to wider bars
+type rollup struct {
+	view   string
+	bucket string
+	// schedule is how often the policy refreshes the buckets invalidated by new or revised candles
+	schedule string
+}
+
+var (
+	hypertables = []hypertable{
+		{table: "crypto_ohlcv_minute_go", chunkInterval: "1 day", compressAfter: "7 days"},
+		{table: "crypto_ohlcv_hourly_go", chunkInterval: "1 month", compressAfter: "3 months"},
+		{table: "crypto_ohlcv_daily_go", chunkInterval: "1 year", compressAfter: "2 years"},
+	}
+	rollups = []rollup{
+		{view: "crypto_ohlcv_hourly_rollup", bucket: "1 hour", schedule: "30 minutes"},
+		{view: "crypto_ohlcv_daily_rollup", bucket: "1 day", schedule: "1 hour"},
+	}
+)
+
+// SetupTimescale turns the minute, hourly and daily candle tables into compressed TimescaleDB
+// hypertables and defines the hourly and daily rollups of minute candles as continuous aggregates.
+// It requires the timescaledb extension to be installed and can be run again, tables which are
+// hypertables already are left as they are.
+//
+// Converting a big table migrates its rows into chunks and locks it meanwhile. Upserting into
+// compressed chunks, as --fetch-all and --repair may do, requires TimescaleDB 2.11 or later.
+func (db *DB) SetupTimescale() error {
+	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS timescaledb").Error; err != nil {
+		db.Logger.Errorf("Error creating timescaledb extension: %v", err)
+		return err
+	}
+
+	for _, h := range hypertables {
+		var exists bool
+		err := db.Raw("SELECT EXISTS (SELECT 1 FROM timescaledb_information.hypertables WHERE hypertable_name = ?)", h.table).
+			Row().Scan(&exists)
+		if err != nil {
+			db.Logger.Errorf("Error checking hypertable %s: %v", h.table, err)
+			return err
+		}
+		if exists {
+			db.Logger.Debugf("%s is a hypertable already", h.table)
+			continue
+		}
+
+		db.Logger.Infof("Converting %s to a hypertable", h.table)
+		if err := execAll(db.DB, hypertableSQL(h)); err != nil {
+			db.Logger.Errorf("Error converting %s to a hypertable: %v", h.table, err)
+			return err
+		}
+	}
+
+	for _, r := range rollups {
+		db.Logger.Infof("Creating continuous aggregate %s", r.view)
+		// continuous aggregates cannot be created in a transaction
+		if err := execAll(db.DB, rollupSQL(r)); err != nil {
+			db.Logger.Errorf("Error creating continuous aggregate %s: %v", r.view, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// hypertableSQL returns the statements converting a candle table to a compressed hypertable.
+// Unique indexes of a hypertable must include its time column, so the primary key becomes (id, timestamp).
+func hypertableSQL(h hypertable) []string {
+	return []string{
+		fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s_pkey, ADD PRIMARY KEY (id, timestamp)", h.table, h.table),
+		fmt.Sprintf("SELECT create_hypertable('%s', 'timestamp', chunk_time_interval => INTERVAL '%s', migrate_data => true)",
+			h.table, h.chunkInterval),
+		fmt.Sprintf("ALTER TABLE %s SET (timescaledb.compress, "+
+			"timescaledb.compress_segmentby = 'trading_symbol, vs_currency, exchange', "+
+			"timescaledb.compress_orderby = 'timestamp DESC')", h.table),
+		fmt.Sprintf("SELECT add_compression_policy('%s', INTERVAL '%s', if_not_exists => true)", h.table, h.compressAfter),
+	}
+}
+
+// rollupSQL returns the statements creating a continuous aggregate of minute candles and its
+// refresh policy. The policy has no start offset so buckets of backfilled or revised candles of
+// any age are refreshed, only the buckets invalidated since the last refresh are computed again.
+func rollupSQL(r rollup) []string {
+	return []string{
+		fmt.Sprintf(`CREATE MATERIALIZED VIEW IF NOT EXISTS %s WITH (timescaledb.continuous) AS
+SELECT trading_symbol, vs_currency, exchange, time_bucket(INTERVAL '%s', timestamp) AS bucket,
+	first(open, timestamp) AS open, MAX(high) AS high, MIN(low) AS low, last(close, timestamp) AS close,
+	SUM(volume_from) AS volume_from, SUM(volume_to) AS volume_to, COUNT(*) AS bars
+FROM crypto_ohlcv_minute_go
+GROUP BY trading_symbol, vs_currency, exchange, bucket
+WITH NO DATA`, r.view, r.bucket),
+		fmt.Sprintf("SELECT add_continuous_aggregate_policy('%s', start_offset => NULL, end_offset => INTERVAL '%s', "+
+			"schedule_interval => INTERVAL '%s', if_not_exists => true)", r.view, r.bucket, r.schedule),
+	}
+}
@@ -0,0 +1,51 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"crypto_project/pkg/models"
+)
+
+func TestHypertables(t *testing.T) {
+	var tables []string
+	for _, h := range hypertables {
+		tables = append(tables, h.table)
+	}
+
+	for _, tf := range []models.Timeframe{models.TimeframeMinute, models.TimeframeHourly, models.TimeframeDaily} {
+		spec, err := models.LookupTimeframe(tf)
+		require.NoError(t, err)
+		assert.Contains(t, tables, spec.Table)
+	}
+}
+
+func TestHypertableSQL(t *testing.T) {
+	stmts := hypertableSQL(hypertable{table: "crypto_ohlcv_minute_go", chunkInterval: "1 day", compressAfter: "7 days"})
+
+	assert.Equal(t, []string{
+		"ALTER TABLE crypto_ohlcv_minute_go DROP CONSTRAINT crypto_ohlcv_minute_go_pkey, ADD PRIMARY KEY (id, timestamp)",
+		"SELECT create_hypertable('crypto_ohlcv_minute_go', 'timestamp', chunk_time_interval => INTERVAL '1 day', migrate_data => true)",
+		"ALTER TABLE crypto_ohlcv_minute_go SET (timescaledb.compress, " +
+			"timescaledb.compress_segmentby = 'trading_symbol, vs_currency, exchange', " +
+			"timescaledb.compress_orderby = 'timestamp DESC')",
+		"SELECT add_compression_policy('crypto_ohlcv_minute_go', INTERVAL '7 days', if_not_exists => true)",
+	}, stmts)
+}
+
+func TestRollupSQL(t *testing.T) {
+	stmts := rollupSQL(rollup{view: "crypto_ohlcv_hourly_rollup", bucket: "1 hour", schedule: "30 minutes"})
+	require.Len(t, stmts, 2)
+
+	assert.Equal(t, `CREATE MATERIALIZED VIEW IF NOT EXISTS crypto_ohlcv_hourly_rollup WITH (timescaledb.continuous) AS
+SELECT trading_symbol, vs_currency, exchange, time_bucket(INTERVAL '1 hour', timestamp) AS bucket,
+	first(open, timestamp) AS open, MAX(high) AS high, MIN(low) AS low, last(close, timestamp) AS close,
+	SUM(volume_from) AS volume_from, SUM(volume_to) AS volume_to, COUNT(*) AS bars
+FROM crypto_ohlcv_minute_go
+GROUP BY trading_symbol, vs_currency, exchange, bucket
+WITH NO DATA`, stmts[0])
+	assert.Equal(t, "SELECT add_continuous_aggregate_policy('crypto_ohlcv_hourly_rollup', start_offset => NULL, "+
+		"end_offset => INTERVAL '1 hour', schedule_interval => INTERVAL '30 minutes', if_not_exists => true)", stmts[1])
+}
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UpsertResult counts what an upsert did with the rows it was given
+type UpsertResult struct {
+	Inserted int
+	Updated  int
+	// Unchanged rows already existed with the same values, they are not written
+	Unchanged int
+}
+
+// Add adds the counts of other to r
+func (r *UpsertResult) Add(other UpsertResult) {
+	r.Inserted += other.Inserted
+	r.Updated += other.Updated
+	r.Unchanged += other.Unchanged
+}
+
+// Total returns how many rows the upsert was given
+func (r UpsertResult) Total() int {
+	return r.Inserted + r.Updated + r.Unchanged
+}
+
+func (r UpsertResult) String() string {
+	return fmt.Sprintf("inserted: %d, updated: %d, unchanged: %d", r.Inserted, r.Updated, r.Unchanged)
+}
+
+// upsertSQL builds the statement inserting the rows of source, a VALUES list or a SELECT, into table.
+// Existing rows are only updated if a value changed. The statement returns the number of inserted
+// and updated rows, a row inserted by the statement has no xmax.
+func upsertSQL(table string, columns []string, source string, conflictColumns []clause.Column) string {
+	keys := make([]string, len(conflictColumns))
+	for i, c := range conflictColumns {
+		keys[i] = c.Name
+	}
+
+	updates := make([]string, len(ohlcvUpdateColumns))
+	changed := make([]string, len(ohlcvUpdateColumns))
+	for i, c := range ohlcvUpdateColumns {
+		updates[i] = fmt.Sprintf("%s = EXCLUDED.%s", c, c)
+		changed[i] = fmt.Sprintf("t.%s IS DISTINCT FROM EXCLUDED.%s", c, c)
+	}
+
+	return fmt.Sprintf(
+		`WITH upserted AS (INSERT INTO %s AS t (%s) %s ON CONFLICT (%s) DO UPDATE SET %s WHERE %s RETURNING xmax = 0 AS inserted) `+
+			`SELECT COUNT(*) FILTER (WHERE inserted), COUNT(*) FILTER (WHERE NOT inserted) FROM upserted`,
+		table, strings.Join(columns, ", "), source,
+		strings.Join(keys, ", "), strings.Join(updates, ", "), strings.Join(changed, " OR "))
+}
+
+// valuesList returns a VALUES list of n rows of columns placeholders
+func valuesList(n int, columns int) string {
+	row := "(" + strings.TrimSuffix(strings.Repeat("?, ", columns), ", ") + ")"
+	return "VALUES " + strings.TrimSuffix(strings.Repeat(row+", ", n), ", ")
+}
+
+// upsertInBatches inserts rows of columns into table with multi-row INSERT ... ON CONFLICT
+// statements of up to batchSize rows each, all in one transaction so either every row
+// or none of them is saved. runID is recorded with the revisions if it is not 0.
+func (db *DB) upsertInBatches(name string, table string, columns []string, conflictColumns []clause.Column, runID int64, rows [][]interface{}) (UpsertResult, error) {
+	var result UpsertResult
+	if len(rows) == 0 {
+		return result, nil
+	}
+
+	db.Logger.Tracef("Starting saving %s data", name)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if runID != 0 {
+			if err := tx.Exec("SELECT set_config(?, ?, true)", fetchRunIDSetting, strconv.FormatInt(runID, 10)).Error; err != nil {
+				return err
+			}
+		}
+
+		for start := 0; start < len(rows); start += db.batchSize {
+			end := start + db.batchSize
+			if end > len(rows) {
+				end = len(rows)
+			}
+
+			var args []interface{}
+			for _, row := range rows[start:end] {
+				args = append(args, row...)
+			}
+
+			var inserted, updated int
+			stmt := upsertSQL(table, columns, valuesList(end-start, len(columns)), conflictColumns)
+			if err := tx.Raw(stmt, args...).Row().Scan(&inserted, &updated); err != nil {
+				return err
+			}
+			result.Add(UpsertResult{Inserted: inserted, Updated: updated, Unchanged: end - start - inserted - updated})
+		}
+		return nil
+	})
+	if err != nil {
+		db.Logger.Errorf("Error saving %s data: %v", name, err)
+		return UpsertResult{}, err
+	}
+	db.Logger.Tracef("Successfully saved %s data, %s", name, result)
+	return result, nil
+}
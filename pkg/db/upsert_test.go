@@ -0,0 +1,22 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValuesList(t *testing.T) {
+	assert.Equal(t, "VALUES (?, ?, ?)", valuesList(1, 3))
+	assert.Equal(t, "VALUES (?, ?), (?, ?), (?, ?)", valuesList(3, 2))
+}
+
+func TestUpsertResult(t *testing.T) {
+	var total UpsertResult
+	total.Add(UpsertResult{Inserted: 2, Updated: 1})
+	total.Add(UpsertResult{Updated: 1, Unchanged: 5})
+
+	assert.Equal(t, UpsertResult{Inserted: 2, Updated: 2, Unchanged: 5}, total)
+	assert.Equal(t, 9, total.Total())
+	assert.Equal(t, "inserted: 2, updated: 2, unchanged: 5", total.String())
+}
@@ -0,0 +1,344 @@
+// Package lake writes candles to a Parquet data lake for analytical queries, e.g. with DuckDB:
+//
+//	SELECT * FROM read_parquet('lake/timeframe=hourly/**/*.parquet', hive_partitioning = true)
+package lake
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/writer"
+
+	"crypto_project/pkg/models"
+)
+
+// parallelism is the number of goroutines parquet-go uses to marshal and unmarshal rows
+const parallelism = 4
+
+// row is a candle in a Parquet file. Prices and volumes are stored as DOUBLE to be
+// queried as numbers, they lose the precision of the numeric columns of the database.
+type row struct {
+	Exchange      string  `parquet:"name=exchange, type=BYTE_ARRAY, convertedtype=UTF8"`
+	TradingSymbol string  `parquet:"name=trading_symbol, type=BYTE_ARRAY, convertedtype=UTF8"`
+	VsCurrency    string  `parquet:"name=vs_currency, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Provider      string  `parquet:"name=provider, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Timestamp     int64   `parquet:"name=timestamp, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	Open          float64 `parquet:"name=open, type=DOUBLE"`
+	High          float64 `parquet:"name=high, type=DOUBLE"`
+	Low           float64 `parquet:"name=low, type=DOUBLE"`
+	Close         float64 `parquet:"name=close, type=DOUBLE"`
+	VolumeFrom    float64 `parquet:"name=volume_from, type=DOUBLE"`
+	VolumeTo      float64 `parquet:"name=volume_to, type=DOUBLE"`
+}
+
+// key identifies a candle like the tpair_ts unique index of the candle tables
+type key struct {
+	exchange      string
+	tradingSymbol string
+	vsCurrency    string
+	timestamp     int64
+}
+
+func (r row) key() key {
+	return key{exchange: r.Exchange, tradingSymbol: r.TradingSymbol, vsCurrency: r.VsCurrency, timestamp: r.Timestamp}
+}
+
+// partition is a Parquet file holding one year of a series
+type partition struct {
+	exchange      string
+	tradingSymbol string
+	vsCurrency    string
+	year          int
+}
+
+func partitionOf(d models.CryptoOHLCV) partition {
+	return partition{exchange: d.Exchange, tradingSymbol: d.TradingSymbol, vsCurrency: d.VsCurrency, year: d.Timestamp.UTC().Year()}
+}
+
+// MergeResult counts the candles merged into the lake by their outcome
+type MergeResult struct {
+	Inserted  int
+	Updated   int
+	Unchanged int
+}
+
+// Add adds the counts of other to r
+func (r *MergeResult) Add(other MergeResult) {
+	r.Inserted += other.Inserted
+	r.Updated += other.Updated
+	r.Unchanged += other.Unchanged
+}
+
+func (r MergeResult) String() string {
+	return fmt.Sprintf("inserted: %d, updated: %d, unchanged: %d", r.Inserted, r.Updated, r.Unchanged)
+}
+
+// Lake stores candles in Parquet files under a directory, partitioned as
+// timeframe=<timeframe>/symbol=<trading symbol>/year=<year>, one file per exchange and quote currency
+type Lake struct {
+	dir string
+	// mu serializes merges, each rewrites whole files
+	mu sync.Mutex
+}
+
+// New returns the lake stored under dir, which is created by the first merge
+func New(dir string) *Lake {
+	return &Lake{dir: dir}
+}
+
+// Dir returns the directory of the lake
+func (l *Lake) Dir() string {
+	return l.dir
+}
+
+// Path returns the path of the Parquet file of a series in a year, e.g.
+// dir/timeframe=minute/symbol=BTC/year=2024/CCCAGG_USD.parquet
+func (l *Lake) Path(timeframe models.Timeframe, exchange string, tradingSymbol string, vsCurrency string, year int) string {
+	return filepath.Join(l.dir,
+		"timeframe="+string(timeframe),
+		"symbol="+tradingSymbol,
+		fmt.Sprintf("year=%d", year),
+		fmt.Sprintf("%s_%s.parquet", exchange, vsCurrency))
+}
+
+// Merge writes data of timeframe to the lake. Candles are keyed like the tpair_ts unique index,
+// a stored candle with the key of one in data is replaced by it, so merging the same data again
+// changes nothing. Files without inserted or updated candles are not rewritten.
+func (l *Lake) Merge(timeframe models.Timeframe, data []models.CryptoOHLCV) (MergeResult, error) {
+	b := l.Batch(timeframe)
+	b.buffer(data)
+	return b.Flush()
+}
+
+// Batch returns a batch buffering candles of timeframe to be merged into the lake
+func (l *Lake) Batch(timeframe models.Timeframe) *Batch {
+	return &Batch{lake: l, timeframe: timeframe, rows: make(map[partition][]row)}
+}
+
+// Batch buffers the candles of a job fetching pages from the most recent to the oldest one, the
+// candles of a partition are merged at once when a page without any of them is added. Each file is
+// then rewritten once per job instead of once per page. A Batch is not safe for concurrent use.
+type Batch struct {
+	lake      *Lake
+	timeframe models.Timeframe
+	rows      map[partition][]row
+	// order is the partitions in the order they were first added
+	order []partition
+}
+
+// Add buffers data, and merges the buffered partitions data has no candle of like Merge
+func (b *Batch) Add(data []models.CryptoOHLCV) (MergeResult, error) {
+	added := b.buffer(data)
+	return b.merge(func(p partition) bool { return !added[p] })
+}
+
+// buffer buffers data, it returns the partitions of data
+func (b *Batch) buffer(data []models.CryptoOHLCV) map[partition]bool {
+	added := make(map[partition]bool)
+	for _, d := range data {
+		p := partitionOf(d)
+		if _, ok := b.rows[p]; !ok {
+			b.order = append(b.order, p)
+		}
+		b.rows[p] = append(b.rows[p], toRow(d))
+		added[p] = true
+	}
+	return added
+}
+
+// Flush merges every buffered partition like Merge
+func (b *Batch) Flush() (MergeResult, error) {
+	return b.merge(func(partition) bool { return true })
+}
+
+// merge merges each of the buffered partitions selected by done and stops buffering them,
+// also if they fail to be merged. It returns the errors of every partition which failed.
+func (b *Batch) merge(done func(partition) bool) (MergeResult, error) {
+	b.lake.mu.Lock()
+	defer b.lake.mu.Unlock()
+
+	var result MergeResult
+	var failed []string
+	var buffered []partition
+	for _, p := range b.order {
+		if !done(p) {
+			buffered = append(buffered, p)
+			continue
+		}
+
+		rows := b.rows[p]
+		delete(b.rows, p)
+		path := b.lake.Path(b.timeframe, p.exchange, p.tradingSymbol, p.vsCurrency, p.year)
+		merged, err := mergeFile(path, rows)
+		result.Add(merged)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", path, err))
+		}
+	}
+	b.order = buffered
+	if len(failed) > 0 {
+		return result, fmt.Errorf("failed to merge %s", strings.Join(failed, ", "))
+	}
+	return result, nil
+}
+
+// Read returns the candles of a series in a year stored in the lake ordered by timestamp,
+// nil if there are none
+func (l *Lake) Read(timeframe models.Timeframe, exchange string, tradingSymbol string, vsCurrency string, year int) ([]models.CryptoOHLCV, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rows, err := readFile(l.Path(timeframe, exchange, tradingSymbol, vsCurrency, year))
+	if err != nil {
+		return nil, err
+	}
+
+	var data []models.CryptoOHLCV
+	for _, r := range rows {
+		data = append(data, r.candle())
+	}
+	return data, nil
+}
+
+// mergeFile merges rows into the file at path and rewrites it if any row is inserted or updated
+func mergeFile(path string, rows []row) (MergeResult, error) {
+	stored, err := readFile(path)
+	if err != nil {
+		return MergeResult{}, err
+	}
+
+	index := make(map[key]int, len(stored))
+	for i, r := range stored {
+		index[r.key()] = i
+	}
+
+	var result MergeResult
+	for _, r := range rows {
+		i, ok := index[r.key()]
+		switch {
+		case !ok:
+			index[r.key()] = len(stored)
+			stored = append(stored, r)
+			result.Inserted++
+		case stored[i] == r:
+			result.Unchanged++
+		default:
+			stored[i] = r
+			result.Updated++
+		}
+	}
+	if result.Inserted == 0 && result.Updated == 0 {
+		return result, nil
+	}
+
+	sort.Slice(stored, func(i, j int) bool { return stored[i].Timestamp < stored[j].Timestamp })
+	if err := writeFile(path, stored); err != nil {
+		return MergeResult{}, err
+	}
+	return result, nil
+}
+
+// readFile returns the rows of the file at path, nil if it does not exist
+func readFile(path string) ([]row, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	file, err := local.NewLocalFileReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	pr, err := reader.NewParquetReader(file, new(row), parallelism)
+	if err != nil {
+		return nil, err
+	}
+	defer pr.ReadStop()
+
+	rows := make([]row, pr.GetNumRows())
+	if err := pr.Read(&rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// writeFile writes rows to a temporary file renamed to path once complete, so readers
+// never see a partially written file
+func writeFile(path string, rows []row) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	file, err := local.NewLocalFileWriter(tmp)
+	if err != nil {
+		return err
+	}
+
+	err = func() error {
+		pw, err := writer.NewParquetWriter(file, new(row), parallelism)
+		if err != nil {
+			return err
+		}
+		pw.CompressionType = parquet.CompressionCodec_SNAPPY
+		for _, r := range rows {
+			if err := pw.Write(r); err != nil {
+				return err
+			}
+		}
+		return pw.WriteStop()
+	}()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func toRow(d models.CryptoOHLCV) row {
+	return row{
+		Exchange:      d.Exchange,
+		TradingSymbol: d.TradingSymbol,
+		VsCurrency:    d.VsCurrency,
+		Provider:      d.Provider,
+		Timestamp:     d.Timestamp.UnixMilli(),
+		Open:          d.Open.InexactFloat64(),
+		High:          d.High.InexactFloat64(),
+		Low:           d.Low.InexactFloat64(),
+		Close:         d.Close.InexactFloat64(),
+		VolumeFrom:    d.VolumeFrom.InexactFloat64(),
+		VolumeTo:      d.VolumeTo.InexactFloat64(),
+	}
+}
+
+func (r row) candle() models.CryptoOHLCV {
+	return models.CryptoOHLCV{
+		TradingSymbol: r.TradingSymbol,
+		VsCurrency:    r.VsCurrency,
+		Exchange:      r.Exchange,
+		Provider:      r.Provider,
+		Timestamp:     time.UnixMilli(r.Timestamp).UTC(),
+		Open:          decimal.NewFromFloat(r.Open),
+		High:          decimal.NewFromFloat(r.High),
+		Low:           decimal.NewFromFloat(r.Low),
+		Close:         decimal.NewFromFloat(r.Close),
+		VolumeFrom:    decimal.NewFromFloat(r.VolumeFrom),
+		VolumeTo:      decimal.NewFromFloat(r.VolumeTo),
+	}
+}
@@ -0,0 +1,166 @@
+package lake
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"crypto_project/pkg/models"
+)
+
+func candle(exchange string, vsCurrency string, ts time.Time, close string) models.CryptoOHLCV {
+	return models.CryptoOHLCV{
+		TradingSymbol: "BTC",
+		VsCurrency:    vsCurrency,
+		Exchange:      exchange,
+		Provider:      "cryptocompare",
+		Timestamp:     ts,
+		Open:          decimal.RequireFromString("1.5"),
+		High:          decimal.RequireFromString("2"),
+		Low:           decimal.RequireFromString("1"),
+		Close:         decimal.RequireFromString(close),
+		VolumeFrom:    decimal.RequireFromString("10"),
+		VolumeTo:      decimal.RequireFromString("15.25"),
+	}
+}
+
+func TestPath(t *testing.T) {
+	l := New("lake")
+	got := l.Path(models.TimeframeMinute, "CCCAGG", "BTC", "USD", 2024)
+	assert.Equal(t, filepath.Join("lake", "timeframe=minute", "symbol=BTC", "year=2024", "CCCAGG_USD.parquet"), got)
+}
+
+func TestMerge(t *testing.T) {
+	l := New(t.TempDir())
+	newYear := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	result, err := l.Merge(models.TimeframeHourly, []models.CryptoOHLCV{
+		candle("CCCAGG", "USD", newYear.Add(-time.Hour), "1.75"),
+		candle("CCCAGG", "USD", newYear.Add(time.Hour), "1.8"),
+		candle("CCCAGG", "USD", newYear, "1.7"),
+		candle("Binance", "USD", newYear, "1.6"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, MergeResult{Inserted: 4}, result)
+
+	for _, path := range []string{
+		l.Path(models.TimeframeHourly, "CCCAGG", "BTC", "USD", 2023),
+		l.Path(models.TimeframeHourly, "CCCAGG", "BTC", "USD", 2024),
+		l.Path(models.TimeframeHourly, "Binance", "BTC", "USD", 2024),
+	} {
+		assert.FileExists(t, path)
+	}
+
+	got, err := l.Read(models.TimeframeHourly, "CCCAGG", "BTC", "USD", 2024)
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	assert.Equal(t, newYear, got[0].Timestamp, "rows must be ordered by timestamp")
+	assert.Equal(t, "1.7", got[0].Close.String())
+	assert.Equal(t, newYear.Add(time.Hour), got[1].Timestamp)
+	assert.Equal(t, "15.25", got[1].VolumeTo.String())
+	assert.Equal(t, "cryptocompare", got[1].Provider)
+
+	path := l.Path(models.TimeframeHourly, "CCCAGG", "BTC", "USD", 2024)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+
+	result, err = l.Merge(models.TimeframeHourly, []models.CryptoOHLCV{
+		candle("CCCAGG", "USD", newYear, "1.7"),
+		candle("CCCAGG", "USD", newYear.Add(time.Hour), "1.8"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, MergeResult{Unchanged: 2}, result)
+	unchanged, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, info.ModTime(), unchanged.ModTime(), "file without changes must not be rewritten")
+
+	result, err = l.Merge(models.TimeframeHourly, []models.CryptoOHLCV{
+		candle("CCCAGG", "USD", newYear, "1.9"),
+		candle("CCCAGG", "USD", newYear.Add(2*time.Hour), "2"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, MergeResult{Inserted: 1, Updated: 1}, result)
+
+	got, err = l.Read(models.TimeframeHourly, "CCCAGG", "BTC", "USD", 2024)
+	require.NoError(t, err)
+	require.Len(t, got, 3)
+	assert.Equal(t, "1.9", got[0].Close.String())
+	assert.Equal(t, newYear.Add(2*time.Hour), got[2].Timestamp)
+	assert.NoFileExists(t, path+".tmp")
+
+	got, err = l.Read(models.TimeframeDaily, "CCCAGG", "BTC", "USD", 2024)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func TestBatch(t *testing.T) {
+	l := New(t.TempDir())
+	newYear := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	path2023 := l.Path(models.TimeframeHourly, "CCCAGG", "BTC", "USD", 2023)
+	path2024 := l.Path(models.TimeframeHourly, "CCCAGG", "BTC", "USD", 2024)
+	b := l.Batch(models.TimeframeHourly)
+
+	// pages from the most recent to the oldest one
+	result, err := b.Add([]models.CryptoOHLCV{
+		candle("CCCAGG", "USD", newYear.Add(time.Hour), "1.7"),
+		candle("CCCAGG", "USD", newYear.Add(2*time.Hour), "1.7"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, MergeResult{}, result)
+	assert.NoFileExists(t, path2024, "partitions are buffered until a page without them is added")
+
+	result, err = b.Add([]models.CryptoOHLCV{
+		candle("CCCAGG", "USD", newYear.Add(-time.Hour), "1.7"),
+		candle("CCCAGG", "USD", newYear, "1.7"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, MergeResult{}, result)
+
+	result, err = b.Add([]models.CryptoOHLCV{
+		candle("CCCAGG", "USD", newYear.Add(-3*time.Hour), "1.7"),
+		candle("CCCAGG", "USD", newYear.Add(-2*time.Hour), "1.7"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, MergeResult{Inserted: 3}, result)
+	assert.FileExists(t, path2024)
+	assert.NoFileExists(t, path2023)
+
+	result, err = b.Flush()
+	require.NoError(t, err)
+	assert.Equal(t, MergeResult{Inserted: 3}, result)
+
+	got, err := l.Read(models.TimeframeHourly, "CCCAGG", "BTC", "USD", 2023)
+	require.NoError(t, err)
+	assert.Len(t, got, 3)
+
+	result, err = b.Flush()
+	require.NoError(t, err)
+	assert.Equal(t, MergeResult{}, result, "flushed partitions are not buffered anymore")
+}
+
+func TestBatchMergeErrors(t *testing.T) {
+	l := New(t.TempDir())
+	newYear := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	path2023 := l.Path(models.TimeframeHourly, "CCCAGG", "BTC", "USD", 2023)
+	path2024 := l.Path(models.TimeframeHourly, "CCCAGG", "BTC", "USD", 2024)
+	// a directory in place of the file of 2023 fails its merge
+	require.NoError(t, os.MkdirAll(path2023, 0o755))
+
+	b := l.Batch(models.TimeframeHourly)
+	_, err := b.Add([]models.CryptoOHLCV{
+		candle("CCCAGG", "USD", newYear.Add(-time.Hour), "1.7"),
+		candle("CCCAGG", "USD", newYear, "1.7"),
+	})
+	require.NoError(t, err)
+
+	result, err := b.Flush()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), path2023)
+	assert.Equal(t, MergeResult{Inserted: 1}, result, "the other partitions are merged nonetheless")
+	assert.FileExists(t, path2024)
+}
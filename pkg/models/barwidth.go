@@ -0,0 +1,57 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// BarWidth is the width of aggregated bars, Aggregate bars of Timeframe are combined into one
+type BarWidth struct {
+	Timeframe Timeframe
+	Aggregate int
+}
+
+// ParseBarWidth parses bar widths like "15m", "4h" or "3d"
+func ParseBarWidth(s string) (BarWidth, error) {
+	if len(s) < 2 {
+		return BarWidth{}, fmt.Errorf("invalid bar width: %q", s)
+	}
+
+	var timeframe Timeframe
+	switch s[len(s)-1] {
+	case 'm':
+		timeframe = TimeframeMinute
+	case 'h':
+		timeframe = TimeframeHourly
+	case 'd':
+		timeframe = TimeframeDaily
+	default:
+		return BarWidth{}, fmt.Errorf("invalid bar width unit: %q", s)
+	}
+
+	aggregate, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil || aggregate < 1 {
+		return BarWidth{}, fmt.Errorf("invalid bar width: %q", s)
+	}
+
+	return BarWidth{Timeframe: timeframe, Aggregate: aggregate}, nil
+}
+
+// String formats the bar width the way ParseBarWidth parses it
+func (w BarWidth) String() string {
+	return fmt.Sprintf("%d%c", w.Aggregate, w.Timeframe[0])
+}
+
+// Seconds returns the width of a bar in seconds
+func (w BarWidth) Seconds() int64 {
+	var seconds int64
+	switch w.Timeframe {
+	case TimeframeMinute:
+		seconds = 60
+	case TimeframeHourly:
+		seconds = 60 * 60
+	default:
+		seconds = 24 * 60 * 60
+	}
+	return seconds * int64(w.Aggregate)
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBarWidth(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    BarWidth
+		seconds int64
+	}{
+		{input: "15m", want: BarWidth{Timeframe: TimeframeMinute, Aggregate: 15}, seconds: 15 * 60},
+		{input: "4h", want: BarWidth{Timeframe: TimeframeHourly, Aggregate: 4}, seconds: 4 * 3600},
+		{input: "3d", want: BarWidth{Timeframe: TimeframeDaily, Aggregate: 3}, seconds: 3 * 86400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseBarWidth(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.input, got.String())
+			assert.Equal(t, tt.seconds, got.Seconds())
+		})
+	}
+
+	for _, input := range []string{"", "m", "0m", "-1h", "4w", "hourly"} {
+		_, err := ParseBarWidth(input)
+		assert.Error(t, err, input)
+	}
+}
@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// Statuses of fetch runs and fetch jobs
+const (
+	FetchStatusRunning   = "running"
+	FetchStatusSucceeded = "succeeded"
+	// FetchStatusPartial means only part of the data could be fetched, the data fetched was saved
+	FetchStatusPartial   = "partial"
+	FetchStatusFailed    = "failed"
+	FetchStatusCancelled = "cancelled"
+)
+
+// FetchRun is a run of cmd/fetchdata
+type FetchRun struct {
+	ID   int64 `gorm:"primaryKey"`
+	Mode string
+	// ConfigHash is the SHA-256 of the config file the run used
+	ConfigHash string
+	StartedAt  time.Time
+	FinishedAt *time.Time
+	Status     string
+	Error      *string
+}
+
+func (FetchRun) TableName() string {
+	return "fetch_runs"
+}
+
+// FetchJob is a download job of a fetch run, fetching one timeframe of a trading pair
+type FetchJob struct {
+	ID            int64 `gorm:"primaryKey"`
+	RunID         int64
+	TradingSymbol string
+	VsCurrency    string
+	Exchange      string
+	Provider      string
+	Timeframe     Timeframe
+	// Limit is the number of bars the job fetched, -1 for all of them
+	Limit int
+	// Since is the time an incremental job fetched bars from, nil if it fetched Limit bars
+	Since      *time.Time
+	StartedAt  time.Time
+	FinishedAt *time.Time
+	// Pages is the number of pages the provider fetched
+	Pages       int
+	RowsFetched int
+	// RowsInserted, RowsUpdated and RowsUnchanged count what saving the fetched rows did
+	RowsInserted  int
+	RowsUpdated   int
+	RowsUnchanged int
+	Status        string
+	Error         *string
+}
+
+func (FetchJob) TableName() string {
+	return "fetch_jobs"
+}
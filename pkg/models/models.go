@@ -6,10 +6,16 @@ import (
 	"github.com/shopspring/decimal"
 )
 
+// DefaultExchange is CryptoCompare's aggregate index, used for candles not fetched from a specific exchange
+const DefaultExchange = "CCCAGG"
+
+// CryptoOHLCV is a candle, the table storing it depends on its Timeframe
 type CryptoOHLCV struct {
 	ID            uint            `gorm:"primaryKey"`
 	TradingSymbol string          `gorm:"type:varchar(10);index:,unique,composite:tpair_ts;index:,composite:tpair;not null"`
 	VsCurrency    string          `gorm:"type:varchar(10);index:,unique,composite:tpair_ts;index:,composite:tpair;not null"`
+	Exchange      string          `gorm:"type:varchar(32);index:,unique,composite:tpair_ts;not null;default:CCCAGG"`
+	Provider      string          `gorm:"type:varchar(20);not null;default:cryptocompare"`
 	Timestamp     time.Time       `gorm:"type:timestamptz;index:,unique,composite:tpair_ts;not null"`
 	Open          decimal.Decimal `gorm:"type:numeric;not null"`
 	High          decimal.Decimal `gorm:"type:numeric;not null"`
@@ -19,26 +25,57 @@ type CryptoOHLCV struct {
 	VolumeTo      decimal.Decimal `gorm:"type:numeric;not null"`
 }
 
-type CryptoOHLCVMinute struct {
-	CryptoOHLCV
-}
-
-type CryptoOHLCVHourly struct {
-	CryptoOHLCV
-}
-
-type CryptoOHLCVDaily struct {
-	CryptoOHLCV
+// CryptoOHLCVAggregated holds bars of custom widths, one series per BarWidth (e.g. "15m", "4h")
+type CryptoOHLCVAggregated struct {
+	ID            uint            `gorm:"primaryKey"`
+	TradingSymbol string          `gorm:"type:varchar(10);index:,unique,composite:tpair_width_ts;index:,composite:tpair_width;not null"`
+	VsCurrency    string          `gorm:"type:varchar(10);index:,unique,composite:tpair_width_ts;index:,composite:tpair_width;not null"`
+	Exchange      string          `gorm:"type:varchar(32);index:,unique,composite:tpair_width_ts;not null;default:CCCAGG"`
+	Provider      string          `gorm:"type:varchar(20);not null;default:cryptocompare"`
+	BarWidth      string          `gorm:"type:varchar(10);index:,unique,composite:tpair_width_ts;index:,composite:tpair_width;not null"`
+	Timestamp     time.Time       `gorm:"type:timestamptz;index:,unique,composite:tpair_width_ts;not null"`
+	Open          decimal.Decimal `gorm:"type:numeric;not null"`
+	High          decimal.Decimal `gorm:"type:numeric;not null"`
+	Low           decimal.Decimal `gorm:"type:numeric;not null"`
+	Close         decimal.Decimal `gorm:"type:numeric;not null"`
+	VolumeFrom    decimal.Decimal `gorm:"type:numeric;not null"`
+	VolumeTo      decimal.Decimal `gorm:"type:numeric;not null"`
 }
 
-func (CryptoOHLCVMinute) TableName() string {
-	return "crypto_ohlcv_minute_go"
+func (CryptoOHLCVAggregated) TableName() string {
+	return "crypto_ohlcv_aggregated_go"
 }
 
-func (CryptoOHLCVHourly) TableName() string {
-	return "crypto_ohlcv_hourly_go"
+// CryptoOHLCVRevision records the values a candle had before an upsert changed them
+type CryptoOHLCVRevision struct {
+	ID int64 `gorm:"primaryKey"`
+	// Table and BarWidth identify the timeframe of the candle, BarWidth is empty
+	// for the built-in timeframes
+	Table         string `gorm:"column:table_name"`
+	BarWidth      string
+	TradingSymbol string
+	VsCurrency    string
+	Exchange      string
+	Timestamp     time.Time
+	OldProvider   string
+	OldOpen       decimal.Decimal
+	OldHigh       decimal.Decimal
+	OldLow        decimal.Decimal
+	OldClose      decimal.Decimal
+	OldVolumeFrom decimal.Decimal
+	OldVolumeTo   decimal.Decimal
+	NewProvider   string
+	NewOpen       decimal.Decimal
+	NewHigh       decimal.Decimal
+	NewLow        decimal.Decimal
+	NewClose      decimal.Decimal
+	NewVolumeFrom decimal.Decimal
+	NewVolumeTo   decimal.Decimal
+	// RunID is the fetch run which saved the new values, nil if it is unknown
+	RunID     *int64
+	RevisedAt time.Time
 }
 
-func (CryptoOHLCVDaily) TableName() string {
-	return "crypto_ohlcv_daily_go"
+func (CryptoOHLCVRevision) TableName() string {
+	return "crypto_ohlcv_revisions"
 }
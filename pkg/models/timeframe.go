@@ -0,0 +1,109 @@
+package models
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Timeframe identifies the granularity of a candle series, e.g. "hourly" or "4h"
+type Timeframe string
+
+const (
+	TimeframeMinute Timeframe = "minute"
+	TimeframeHourly Timeframe = "hourly"
+	TimeframeDaily  Timeframe = "daily"
+)
+
+// TimeframeSpec describes how the candles of a timeframe are stored
+type TimeframeSpec struct {
+	Timeframe Timeframe
+	// Table stores the candles, with the columns of CryptoOHLCV
+	Table string
+	// Interval is the width of a candle
+	Interval time.Duration
+	// History is how far back the API serves candles of the timeframe, zero if there is no limit
+	History time.Duration
+	// BarWidth is set for aggregated timeframes, whose candles are stored in the shared
+	// CryptoOHLCVAggregated table keyed by bar width instead of in Table
+	BarWidth string
+}
+
+// AvailableSince returns the time of the oldest candle the API still serves at now, zero if there is no limit
+func (s TimeframeSpec) AvailableSince(now time.Time) time.Time {
+	if s.History == 0 {
+		return time.Time{}
+	}
+	return now.Add(-s.History)
+}
+
+// Aggregated reports whether the candles are stored in the shared aggregated table
+func (s TimeframeSpec) Aggregated() bool {
+	return s.BarWidth != ""
+}
+
+// MinuteHistory is how far back CryptoCompare serves minute candles
+const MinuteHistory = 7 * 24 * time.Hour
+
+var (
+	timeframesMu sync.RWMutex
+	timeframes   = map[Timeframe]TimeframeSpec{}
+	// timeframeOrder keeps the registration order for Timeframes
+	timeframeOrder []Timeframe
+)
+
+func init() {
+	RegisterTimeframe(TimeframeSpec{Timeframe: TimeframeMinute, Table: "crypto_ohlcv_minute_go", Interval: time.Minute, History: MinuteHistory})
+	RegisterTimeframe(TimeframeSpec{Timeframe: TimeframeHourly, Table: "crypto_ohlcv_hourly_go", Interval: time.Hour})
+	RegisterTimeframe(TimeframeSpec{Timeframe: TimeframeDaily, Table: "crypto_ohlcv_daily_go", Interval: 24 * time.Hour})
+}
+
+// RegisterTimeframe makes a timeframe known to the repository, registering it again replaces its spec.
+// Table has to be created by a migration of pkg/db with the columns and indexes of CryptoOHLCV.
+func RegisterTimeframe(spec TimeframeSpec) {
+	timeframesMu.Lock()
+	defer timeframesMu.Unlock()
+
+	if _, ok := timeframes[spec.Timeframe]; !ok {
+		timeframeOrder = append(timeframeOrder, spec.Timeframe)
+	}
+	timeframes[spec.Timeframe] = spec
+}
+
+// RegisterAggregatedTimeframe registers a bar width like "15m" as a timeframe stored in the aggregated table,
+// history is how far back the API serves it, zero if there is no limit
+func RegisterAggregatedTimeframe(barWidth string, interval time.Duration, history time.Duration) Timeframe {
+	tf := Timeframe(barWidth)
+	RegisterTimeframe(TimeframeSpec{
+		Timeframe: tf,
+		Table:     CryptoOHLCVAggregated{}.TableName(),
+		Interval:  interval,
+		History:   history,
+		BarWidth:  barWidth,
+	})
+	return tf
+}
+
+// LookupTimeframe returns the spec of a registered timeframe
+func LookupTimeframe(tf Timeframe) (TimeframeSpec, error) {
+	timeframesMu.RLock()
+	defer timeframesMu.RUnlock()
+
+	spec, ok := timeframes[tf]
+	if !ok {
+		return TimeframeSpec{}, fmt.Errorf("unknown timeframe: %s", tf)
+	}
+	return spec, nil
+}
+
+// Timeframes returns the specs of all registered timeframes in registration order
+func Timeframes() []TimeframeSpec {
+	timeframesMu.RLock()
+	defer timeframesMu.RUnlock()
+
+	specs := make([]TimeframeSpec, len(timeframeOrder))
+	for i, tf := range timeframeOrder {
+		specs[i] = timeframes[tf]
+	}
+	return specs
+}
@@ -0,0 +1,134 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"crypto_project/pkg/binance"
+	"crypto_project/pkg/models"
+)
+
+const binanceExchange = "Binance"
+
+// binanceIntervals are the kline intervals supported by the Binance API
+var binanceIntervals = map[string]bool{
+	"1m": true, "3m": true, "5m": true, "15m": true, "30m": true,
+	"1h": true, "2h": true, "4h": true, "6h": true, "8h": true, "12h": true,
+	"1d": true, "3d": true,
+}
+
+// Binance adapts binance.Client to the Provider interface, markets are traded
+// on Binance as Symbol+VsCurrency (e.g. BTC and USDT as "BTCUSDT")
+type Binance struct {
+	client *binance.Client
+}
+
+// NewBinance creates a Provider fetching klines with client
+func NewBinance(client *binance.Client) *Binance {
+	return &Binance{client: client}
+}
+
+func (p *Binance) Name() string {
+	return "binance"
+}
+
+// Exchange always returns Binance
+func (p *Binance) Exchange(market Market) string {
+	return binanceExchange
+}
+
+func (p *Binance) FetchOHLCV(ctx context.Context, market Market, timeframe models.Timeframe, limit int) ([]Bar, error) {
+	symbol, interval, err := binanceSymbolAndInterval(market, timeframe)
+	if err != nil {
+		return nil, err
+	}
+
+	klines, err := p.client.FetchKlines(ctx, symbol, interval, limit, time.Time{})
+	return fromBinance(klines), err
+}
+
+func (p *Binance) FetchOHLCVRange(ctx context.Context, market Market, timeframe models.Timeframe, from, to time.Time) ([]Bar, int, error) {
+	symbol, interval, err := binanceSymbolAndInterval(market, timeframe)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	klines, pages, err := p.client.FetchKlineRange(ctx, symbol, interval, from, to)
+	return fromBinance(klines), pages, err
+}
+
+func (p *Binance) AllOHLCVPages(ctx context.Context, market Market, timeframe models.Timeframe) PageIterator {
+	symbol, interval, err := binanceSymbolAndInterval(market, timeframe)
+	if err != nil {
+		return &errPages{err: err}
+	}
+	return &binancePages{p.client.AllKlinePages(ctx, symbol, interval)}
+}
+
+// binanceSymbolAndInterval maps market and timeframe to the symbol and interval parameters of the API
+func binanceSymbolAndInterval(market Market, timeframe models.Timeframe) (string, string, error) {
+	if market.Exchange != "" && market.Exchange != binanceExchange {
+		return "", "", fmt.Errorf("binance provider cannot fetch markets of exchange %s", market.Exchange)
+	}
+
+	var interval string
+	switch timeframe {
+	case models.TimeframeMinute:
+		interval = "1m"
+	case models.TimeframeHourly:
+		interval = "1h"
+	case models.TimeframeDaily:
+		interval = "1d"
+	default:
+		width, err := models.ParseBarWidth(string(timeframe))
+		if err != nil {
+			return "", "", fmt.Errorf("invalid timeframe: %s", timeframe)
+		}
+		interval = width.String()
+	}
+	if !binanceIntervals[interval] {
+		return "", "", fmt.Errorf("timeframe %s is not supported by binance", timeframe)
+	}
+
+	return market.Symbol + market.VsCurrency, interval, nil
+}
+
+// binancePages converts the pages of a binance.KlinePageIterator to bars
+type binancePages struct {
+	*binance.KlinePageIterator
+}
+
+func (it *binancePages) Page() []Bar {
+	return fromBinance(it.KlinePageIterator.Page())
+}
+
+func fromBinance(klines []binance.Kline) []Bar {
+	if klines == nil {
+		return nil
+	}
+
+	bars := make([]Bar, len(klines))
+	for i, k := range klines {
+		bars[i] = Bar{
+			Time:       k.OpenTime,
+			Open:       k.Open,
+			High:       k.High,
+			Low:        k.Low,
+			Close:      k.Close,
+			VolumeFrom: k.Volume,
+			VolumeTo:   k.QuoteAssetVolume,
+		}
+	}
+	return bars
+}
+
+// errPages is an iterator which stops right away with err
+type errPages struct {
+	err error
+}
+
+func (it *errPages) Next() bool  { return false }
+func (it *errPages) Page() []Bar { return nil }
+func (it *errPages) Pages() int  { return 0 }
+func (it *errPages) Err() error  { return it.err }
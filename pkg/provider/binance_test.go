@@ -0,0 +1,39 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"crypto_project/pkg/models"
+)
+
+func TestBinanceSymbolAndInterval(t *testing.T) {
+	tests := []struct {
+		timeframe models.Timeframe
+		interval  string
+	}{
+		{timeframe: "minute", interval: "1m"},
+		{timeframe: "hourly", interval: "1h"},
+		{timeframe: "daily", interval: "1d"},
+		{timeframe: "15m", interval: "15m"},
+		{timeframe: "4h", interval: "4h"},
+	}
+
+	market := Market{Symbol: "BTC", VsCurrency: "USDT"}
+	for _, tt := range tests {
+		t.Run(string(tt.timeframe), func(t *testing.T) {
+			symbol, interval, err := binanceSymbolAndInterval(market, tt.timeframe)
+			require.NoError(t, err)
+			assert.Equal(t, "BTCUSDT", symbol)
+			assert.Equal(t, tt.interval, interval)
+		})
+	}
+
+	_, _, err := binanceSymbolAndInterval(market, "7m")
+	assert.Error(t, err)
+
+	_, _, err = binanceSymbolAndInterval(Market{Exchange: "Kraken", Symbol: "BTC", VsCurrency: "USD"}, "hourly")
+	assert.Error(t, err)
+}
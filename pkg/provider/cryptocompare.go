@@ -0,0 +1,120 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"crypto_project/pkg/cryptocompare"
+	"crypto_project/pkg/models"
+)
+
+// CryptoCompare adapts cryptocompare.Client to the Provider interface
+type CryptoCompare struct {
+	client *cryptocompare.Client
+}
+
+// NewCryptoCompare creates a Provider fetching bars with client
+func NewCryptoCompare(client *cryptocompare.Client) *CryptoCompare {
+	return &CryptoCompare{client: client}
+}
+
+func (p *CryptoCompare) Name() string {
+	return "cryptocompare"
+}
+
+// Exchange returns market.Exchange, or the CCCAGG aggregate index if it is empty
+func (p *CryptoCompare) Exchange(market Market) string {
+	if market.Exchange == "" {
+		return models.DefaultExchange
+	}
+	return market.Exchange
+}
+
+func (p *CryptoCompare) clientFor(market Market) *cryptocompare.Client {
+	if market.Exchange == "" {
+		return p.client
+	}
+	return p.client.ForExchange(market.Exchange)
+}
+
+func (p *CryptoCompare) FetchOHLCV(ctx context.Context, market Market, timeframe models.Timeframe, limit int) ([]Bar, error) {
+	client := p.clientFor(market)
+
+	var data []cryptocompare.OHLCVData
+	var err error
+	switch timeframe {
+	case models.TimeframeMinute:
+		data, err = client.FetchMinuteOHLCVDataContext(ctx, market.Symbol, market.VsCurrency, limit)
+	case models.TimeframeHourly:
+		data, err = client.FetchHourlyOHLCVDataContext(ctx, market.Symbol, market.VsCurrency, limit)
+	case models.TimeframeDaily:
+		data, err = client.FetchDailyOHLCVDataContext(ctx, market.Symbol, market.VsCurrency, limit)
+	default:
+		width, parseErr := models.ParseBarWidth(string(timeframe))
+		if parseErr != nil {
+			return nil, fmt.Errorf("invalid timeframe: %s", timeframe)
+		}
+		data, err = client.FetchAggregatedOHLCVDataContext(ctx, market.Symbol, market.VsCurrency, width, limit)
+	}
+
+	return fromCryptoCompare(data), err
+}
+
+func (p *CryptoCompare) FetchOHLCVRange(ctx context.Context, market Market, timeframe models.Timeframe, from, to time.Time) ([]Bar, int, error) {
+	client := p.clientFor(market)
+
+	var data []cryptocompare.OHLCVData
+	var pages int
+	var err error
+	switch timeframe {
+	case models.TimeframeMinute, models.TimeframeHourly, models.TimeframeDaily:
+		data, pages, err = client.FetchOHLCVRangeContext(ctx, market.Symbol, market.VsCurrency, timeframe, from, to)
+	default:
+		width, parseErr := models.ParseBarWidth(string(timeframe))
+		if parseErr != nil {
+			return nil, 0, fmt.Errorf("invalid timeframe: %s", timeframe)
+		}
+		data, pages, err = client.FetchAggregatedOHLCVRangeContext(ctx, market.Symbol, market.VsCurrency, width, from, to)
+	}
+
+	return fromCryptoCompare(data), pages, err
+}
+
+func (p *CryptoCompare) AllOHLCVPages(ctx context.Context, market Market, timeframe models.Timeframe) PageIterator {
+	client := p.clientFor(market)
+
+	if width, err := models.ParseBarWidth(string(timeframe)); err == nil {
+		return &cryptoComparePages{client.AllAggregatedOHLCVDataPages(ctx, market.Symbol, market.VsCurrency, width)}
+	}
+	return &cryptoComparePages{client.AllOHLCVDataPages(ctx, market.Symbol, market.VsCurrency, timeframe)}
+}
+
+// cryptoComparePages converts the pages of a cryptocompare.PageIterator to bars
+type cryptoComparePages struct {
+	*cryptocompare.PageIterator
+}
+
+func (it *cryptoComparePages) Page() []Bar {
+	return fromCryptoCompare(it.PageIterator.Page())
+}
+
+func fromCryptoCompare(data []cryptocompare.OHLCVData) []Bar {
+	if data == nil {
+		return nil
+	}
+
+	bars := make([]Bar, len(data))
+	for i, d := range data {
+		bars[i] = Bar{
+			Time:       time.Unix(d.Time, 0).UTC(),
+			Open:       d.Open,
+			High:       d.High,
+			Low:        d.Low,
+			Close:      d.Close,
+			VolumeFrom: d.VolumeFrom,
+			VolumeTo:   d.VolumeTo,
+		}
+	}
+	return bars
+}
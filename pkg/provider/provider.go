@@ -0,0 +1,62 @@
+package provider
+
+import (
+	"context"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"crypto_project/pkg/models"
+)
+
+// Bar is an OHLCV bar normalized across providers
+type Bar struct {
+	// Time is the open time of the bar
+	Time time.Time
+	Open decimal.Decimal
+	High decimal.Decimal
+	Low  decimal.Decimal
+	// Close is the last price of the bar
+	Close decimal.Decimal
+	// VolumeFrom is the traded volume in the base currency
+	VolumeFrom decimal.Decimal
+	// VolumeTo is the traded volume in the quote currency
+	VolumeTo decimal.Decimal
+}
+
+// Market is a trading pair, optionally on a specific exchange
+type Market struct {
+	// Exchange is empty if the provider should pick its default venue
+	Exchange   string
+	Symbol     string
+	VsCurrency string
+}
+
+// PageIterator walks the whole history of a market one page at a time,
+// from the most recent page back to the oldest one
+type PageIterator interface {
+	// Next fetches the next page, it returns false when there is no more data or an error occurred
+	Next() bool
+	// Page returns the bars of the last page fetched by Next, sorted by time
+	Page() []Bar
+	// Pages returns how many pages have been fetched so far
+	Pages() int
+	// Err returns the error which stopped the iteration, nil if all data has been fetched
+	Err() error
+}
+
+// Provider is a source of OHLCV bars. Timeframes are "minute", "hourly", "daily",
+// or aggregated bar widths like "15m" and "4h".
+type Provider interface {
+	// Name identifies the provider, it is stored with every candle it produced
+	Name() string
+	// Exchange returns the exchange whose prices are returned for market
+	Exchange(market Market) string
+	// FetchOHLCV fetches the most recent bars of market up to given limit with a single request
+	FetchOHLCV(ctx context.Context, market Market, timeframe models.Timeframe, limit int) ([]Bar, error)
+	// FetchOHLCVRange fetches the bars of market opening in [from, to), sorted by time, it returns
+	// them with the number of pages fetched
+	FetchOHLCVRange(ctx context.Context, market Market, timeframe models.Timeframe, from, to time.Time) ([]Bar, int, error)
+	// AllOHLCVPages returns an iterator over all available bars of market
+	AllOHLCVPages(ctx context.Context, market Market, timeframe models.Timeframe) PageIterator
+}